@@ -10,6 +10,11 @@ import (
 type Config struct {
 	MongoURI string
 	JWTKey   []byte
+	// MediaDir is where uploaded exercise media is stored. The server
+	// serves it at /media; MediaBaseURL is the prefix of the media links
+	// handed to clients, e.g. a CDN in front of the server.
+	MediaDir     string
+	MediaBaseURL string
 }
 
 func Load() *Config {
@@ -28,9 +33,20 @@ func Load() *Config {
 
 	log.Printf("Loaded MONGO_URI: %s", maskURI(mongoURI))
 
+	mediaDir, exists := os.LookupEnv("MEDIA_DIR")
+	if !exists {
+		mediaDir = "media"
+	}
+	mediaBaseURL, exists := os.LookupEnv("MEDIA_BASE_URL")
+	if !exists {
+		mediaBaseURL = "/media"
+	}
+
 	return &Config{
-		MongoURI: mongoURI,
-		JWTKey:   jwtKey,
+		MongoURI:     mongoURI,
+		JWTKey:       jwtKey,
+		MediaDir:     mediaDir,
+		MediaBaseURL: mediaBaseURL,
 	}
 }
 
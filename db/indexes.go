@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the handlers rely on. Creating an index
+// that already exists with the same definition is a no-op.
+func EnsureIndexes(client *mongo.Client) error {
+	database := client.Database("gym-app")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The muscles of an exercise are IDs rather than words, so only the name
+	// is text indexed. A collection has a single text index, so the earlier
+	// one that included the muscles is dropped first.
+	exercises := database.Collection("exercises")
+	if _, err := exercises.Indexes().DropOne(ctx, "exercise_search"); err != nil && !indexMissing(err) {
+		return err
+	}
+	_, err := exercises.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "Exercise", Value: "text"}},
+		Options: options.Index().SetName("exercise_name_search"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("routines").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "exercises.exercise_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "template.visibility", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("programs").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("schedule").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("sessions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "started_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "calendar_token_hash", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("exercise_revisions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "exercise_id", Value: 1}, {Key: "revision", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// indexMissing reports whether dropping an index failed because the index
+// or its collection does not exist.
+func indexMissing(err error) bool {
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) {
+		return commandErr.Code == 26 || commandErr.Code == 27
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type migration struct {
+	name string
+	run  func(ctx context.Context, database *mongo.Database) (int64, error)
+}
+
+// migrations are run in order by Migrate. Each one must be safe to run
+// again on an already migrated database.
+var migrations = []migration{
+	{name: "exercise-muscle-ids", run: migrateExerciseMuscles},
+	{name: "exercise-equipment", run: migrateExerciseEquipment},
+	{name: "exercise-instruction-steps", run: migrateExerciseInstructions},
+}
+
+// Migrate brings existing documents up to date with the current models.
+func Migrate(client *mongo.Client) error {
+	database := client.Database("gym-app")
+	for _, m := range migrations {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		count, err := m.run(ctx, database)
+		cancel()
+		if err != nil {
+			return err
+		}
+		log.Printf("Migration %s: %d documents updated", m.name, count)
+	}
+	return nil
+}
+
+// migrateExerciseMuscles converts the comma separated "Primary Muscles" and
+// "Secondary Muscles" strings into arrays of muscle IDs. Documents with
+// names missing from the alias table keep their legacy fields so they can be
+// fixed by hand.
+func migrateExerciseMuscles(ctx context.Context, database *mongo.Database) (int64, error) {
+	collection := database.Collection("exercises")
+	filter := bson.M{"$or": []bson.M{
+		{"Primary Muscles": bson.M{"$exists": true}},
+		{"Secondary Muscles": bson.M{"$exists": true}},
+	}}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var legacy []struct {
+		ID               primitive.ObjectID `bson:"_id"`
+		Exercise         string             `bson:"Exercise"`
+		PrimaryMuscles   string             `bson:"Primary Muscles"`
+		SecondaryMuscles string             `bson:"Secondary Muscles"`
+	}
+	if err := cursor.All(ctx, &legacy); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, doc := range legacy {
+		primary, unknown := models.ParseMuscleList(doc.PrimaryMuscles)
+		secondary, unknownSecondary := models.ParseMuscleList(doc.SecondaryMuscles)
+		unknown = append(unknown, unknownSecondary...)
+		if len(unknown) > 0 {
+			log.Printf("Skipping exercise %q: unknown muscles %s", doc.Exercise, strings.Join(unknown, ", "))
+			continue
+		}
+
+		update := bson.M{
+			"$set":   bson.M{"primary_muscles": primary, "secondary_muscles": secondary},
+			"$unset": bson.M{"Primary Muscles": "", "Secondary Muscles": ""},
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, update); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// migrateExerciseEquipment infers the equipment of exercises that have none
+// from their names.
+func migrateExerciseEquipment(ctx context.Context, database *mongo.Database) (int64, error) {
+	collection := database.Collection("exercises")
+	cursor, err := collection.Find(ctx, bson.M{"equipment": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var exercises []models.Exercise
+	if err := cursor.All(ctx, &exercises); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, exercise := range exercises {
+		update := bson.M{"$set": bson.M{"equipment": models.InferEquipment(exercise.Exercise)}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": exercise.ID}, update); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// migrateExerciseInstructions wraps instructions stored as a single string,
+// before they became a list of steps, in an array. Translations are
+// migrated the same way; empty strings are removed.
+func migrateExerciseInstructions(ctx context.Context, database *mongo.Database) (int64, error) {
+	collection := database.Collection("exercises")
+	filter := bson.M{"$or": []bson.M{
+		{"instructions": bson.M{"$type": "string"}},
+		{"translations": bson.M{"$exists": true}},
+	}}
+	opts := options.Find().SetProjection(bson.M{"instructions": 1, "translations": 1})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var legacy []struct {
+		ID           primitive.ObjectID `bson:"_id"`
+		Instructions interface{}        `bson:"instructions"`
+		Translations map[string]bson.M  `bson:"translations"`
+	}
+	if err := cursor.All(ctx, &legacy); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, doc := range legacy {
+		set, unset := bson.M{}, bson.M{}
+		wrap := func(field string, value interface{}) {
+			text, ok := value.(string)
+			if !ok {
+				return
+			}
+			if text == "" {
+				unset[field] = ""
+			} else {
+				set[field] = []string{text}
+			}
+		}
+		wrap("instructions", doc.Instructions)
+		for locale, translation := range doc.Translations {
+			wrap("translations."+locale+".instructions", translation["instructions"])
+		}
+		if len(set) == 0 && len(unset) == 0 {
+			continue
+		}
+
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, update); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// seedExercise mirrors the layout of sample.json, which uses the original
+// spreadsheet column names as keys.
+type seedExercise struct {
+	Exercise         string `json:"Exercise"`
+	PrimaryMuscles   string `json:"Primary Muscles"`
+	SecondaryMuscles string `json:"Secondary Muscles"`
+	Type             string `json:"Type"`
+	Focus            string `json:"Focus"`
+}
+
+type SeedResult struct {
+	Inserted int64 `json:"inserted"`
+	Updated  int64 `json:"updated"`
+	Skipped  int64 `json:"skipped"`
+}
+
+// focusAliases maps known spelling variants to the canonical Focus value.
+var focusAliases = map[string]string{
+	"leg":       "Leg",
+	"legs":      "Leg",
+	"back":      "Back",
+	"chest":     "Chest",
+	"shoulder":  "Shoulders",
+	"shoulders": "Shoulders",
+	"bicep":     "Bicep",
+	"biceps":    "Bicep",
+	"tricep":    "Tricep",
+	"triceps":   "Tricep",
+}
+
+// regionFocus is used to infer a missing Focus from the region of the first
+// primary muscle. Arm muscles map to their own Focus values.
+var regionFocus = map[string]string{
+	"legs":      "Leg",
+	"back":      "Back",
+	"chest":     "Chest",
+	"shoulders": "Shoulders",
+}
+
+var armFocus = map[string]string{
+	"biceps":  "Bicep",
+	"triceps": "Tricep",
+}
+
+// SeedExercises upserts the exercises in the given JSON file into the
+// exercises collection, keyed on the exercise name. Running it again with
+// the same file leaves the collection untouched.
+func SeedExercises(client *mongo.Client, path string) (*SeedResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []seedExercise
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	result := &SeedResult{}
+	seen := make(map[string]bool)
+	var writes []mongo.WriteModel
+	for _, entry := range entries {
+		exercise, ok := normalizeSeedExercise(entry)
+		key := strings.ToLower(exercise.Exercise)
+		if !ok || seen[key] {
+			result.Skipped++
+			continue
+		}
+		seen[key] = true
+
+		update := bson.M{
+			"$set": bson.M{
+				"Exercise":          exercise.Exercise,
+				"primary_muscles":   exercise.PrimaryMuscleIDs,
+				"secondary_muscles": exercise.SecondaryMuscleIDs,
+				"Type":              exercise.Type,
+				"Focus":             exercise.Focus,
+			},
+			"$unset": bson.M{"Primary Muscles": "", "Secondary Muscles": ""},
+			// Equipment may be corrected by hand after the first import
+			"$setOnInsert": bson.M{"equipment": models.InferEquipment(exercise.Exercise)},
+		}
+		// Only the global catalog is seeded, never private exercises
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"Exercise": exercise.Exercise, "owner_id": bson.M{"$exists": false}}).
+			SetUpdate(update).
+			SetUpsert(true))
+	}
+
+	if len(writes) == 0 {
+		return result, nil
+	}
+
+	collection := client.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return nil, err
+	}
+
+	result.Inserted = res.UpsertedCount
+	result.Updated = res.ModifiedCount
+	result.Skipped += res.MatchedCount - res.ModifiedCount
+	return result, nil
+}
+
+// normalizeSeedExercise cleans up a catalog entry and resolves its muscles
+// against the registry. It reports false for entries that cannot be stored.
+func normalizeSeedExercise(entry seedExercise) (models.Exercise, bool) {
+	exercise := models.Exercise{
+		Exercise: strings.Join(strings.Fields(entry.Exercise), " "),
+		Type:     strings.TrimSpace(entry.Type),
+		Focus:    strings.TrimSpace(entry.Focus),
+	}
+
+	var unknown, unknownSecondary []string
+	exercise.PrimaryMuscleIDs, unknown = models.ParseMuscleList(entry.PrimaryMuscles)
+	exercise.SecondaryMuscleIDs, unknownSecondary = models.ParseMuscleList(entry.SecondaryMuscles)
+	if exercise.Exercise == "" || len(exercise.PrimaryMuscleIDs) == 0 ||
+		len(unknown) > 0 || len(unknownSecondary) > 0 {
+		return exercise, false
+	}
+
+	if canonical, ok := focusAliases[strings.ToLower(exercise.Focus)]; ok {
+		exercise.Focus = canonical
+	}
+	if exercise.Focus == "" {
+		primary, _ := models.LookupMuscle(exercise.PrimaryMuscleIDs[0])
+		exercise.Focus = regionFocus[primary.Region]
+		if primary.Region == "arms" {
+			exercise.Focus = armFocus[primary.ID]
+		}
+	}
+
+	switch strings.ToLower(exercise.Type) {
+	case "compound":
+		exercise.Type = "Compound"
+	case "isolation":
+		exercise.Type = "Isolation"
+	default:
+		// Every compound lift in the catalog works at least three muscles.
+		if len(exercise.PrimaryMuscleIDs)+len(exercise.SecondaryMuscleIDs) >= 3 {
+			exercise.Type = "Compound"
+		} else {
+			exercise.Type = "Isolation"
+		}
+	}
+	return exercise, true
+}
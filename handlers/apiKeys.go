@@ -149,24 +149,28 @@ func (h *APIKeyHandler) GetByAccount(c *gin.Context) {
 }
 
 func (h *APIKeyHandler) GetAll(c *gin.Context) {
+	query, err := parseListQuery(c, models.ApiKey{}, "account", "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	collection := h.DB.Database("gym-app").Collection("api_keys")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
+	var apiKeys []models.ApiKey
+	if err = findPage(ctx, c, collection, bson.M{}, query, &apiKeys); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var apiKeys []models.ApiKey
-	if err = cursor.All(ctx, &apiKeys); err != nil {
+	response, err := query.project(apiKeys)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	c.JSON(http.StatusOK, apiKeys)
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *APIKeyHandler) Delete(c *gin.Context) {
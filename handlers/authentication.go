@@ -5,6 +5,7 @@ import (
 	"gym-api/m/config"
 	"gym-api/m/models"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/casbin/casbin/v2"
@@ -16,7 +17,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var cfg = config.Load()
+// cfg is loaded on first use, so that the package can be loaded without
+// the server environment, e.g. in tests.
+var cfg = sync.OnceValue(config.Load)
 
 type AuthenticationHandler struct {
 	DB       *mongo.Client
@@ -141,7 +144,7 @@ func (h *AuthenticationHandler) Login(c *gin.Context) {
 		"roles":   roles,
 		"exp":     time.Now().Add(24 * time.Hour).Unix(),
 	})
-	tokenString, err := token.SignedString(cfg.JWTKey)
+	tokenString, err := token.SignedString(cfg().JWTKey)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -185,7 +188,7 @@ func (h *AuthenticationHandler) GenerateApplicationJWT(c *gin.Context) {
 		"roles":          roles,
 		"exp":            time.Now().Add(24 * time.Hour).Unix(),
 	})
-	tokenString, err := token.SignedString(cfg.JWTKey)
+	tokenString, err := token.SignedString(cfg().JWTKey)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -194,21 +197,25 @@ func (h *AuthenticationHandler) GenerateApplicationJWT(c *gin.Context) {
 }
 
 func (h *AuthenticationHandler) GetApplications(c *gin.Context) {
+	query, err := parseListQuery(c, models.Application{}, "name", "status", "created_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	collection := h.DB.Database("gym-app").Collection("applications")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
+	var applications []models.Application
+	if err := findPage(ctx, c, collection, bson.M{}, query, &applications); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
-	var applications []models.Application
-	if err := cursor.All(ctx, &applications); err != nil {
+	response, err := query.project(applications)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, applications)
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *AuthenticationHandler) UpdateApplicationStatus(c *gin.Context) {
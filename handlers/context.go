@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userIDFromContext returns the ID of the user authenticated by the JWT
+// middleware. Requests authenticated with an API key or an application
+// token have no user ID.
+func userIDFromContext(c *gin.Context) (primitive.ObjectID, error) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		return primitive.NilObjectID, errors.New("User ID not found in context")
+	}
+	userIDStr, ok := userID.(string)
+	if !ok {
+		return primitive.NilObjectID, errors.New("User ID in context is not a string")
+	}
+	objectID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return primitive.NilObjectID, errors.New("Invalid user ID format")
+	}
+	return objectID, nil
+}
+
+// actorFromContext names the caller for audit records: the email of a JWT
+// user, or the account of the API key.
+func actorFromContext(c *gin.Context) string {
+	if email, ok := c.Get("user_email"); ok {
+		if emailStr, ok := email.(string); ok && emailStr != "" {
+			return emailStr
+		}
+	}
+	return c.GetString("api_key_user")
+}
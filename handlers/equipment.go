@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EquipmentHandler struct{}
+
+func (h *EquipmentHandler) GetAll(c *gin.Context) {
+	c.JSON(http.StatusOK, models.EquipmentList)
+}
+
+// resolveEquipment returns the canonical IDs for a list of equipment IDs or
+// names, or an error naming the first unknown one.
+func resolveEquipment(items []string) ([]string, error) {
+	ids := []string{}
+	seen := make(map[string]bool)
+	for _, item := range items {
+		equipment, ok := models.LookupEquipment(item)
+		if !ok {
+			return nil, errors.New("unknown equipment: " + strings.TrimSpace(item))
+		}
+		if !seen[equipment.ID] {
+			seen[equipment.ID] = true
+			ids = append(ids, equipment.ID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gym-api/m/models"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// adminRole is the casbin role allowed to edit the global exercise catalog.
+const adminRole = "admin"
+
+// isAdmin reports whether the caller has the admin role.
+func isAdmin(c *gin.Context, enforcer *casbin.Enforcer) bool {
+	return hasRole(callerRoles(c, enforcer), adminRole)
+}
+
+// ownedFilter restricts queries on per-user documents such as routines to
+// the caller's own documents. Admins are not restricted. It writes an error
+// response and returns false when the caller has no user to scope to.
+func ownedFilter(c *gin.Context, enforcer *casbin.Enforcer) (bson.M, bool) {
+	if isAdmin(c, enforcer) {
+		return bson.M{}, true
+	}
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return bson.M{"user_id": userID}, true
+}
+
+// callerRoles returns the casbin roles of the caller, including inherited
+// ones. Requests made on behalf of a user are judged by the user; requests
+// made with only an API key are judged by the key's account.
+func callerRoles(c *gin.Context, enforcer *casbin.Enforcer) []string {
+	subject := c.GetString("api_key_user")
+	if email, ok := c.Get("user_email"); ok {
+		subject, _ = email.(string)
+	}
+	if subject == "" || enforcer == nil {
+		return nil
+	}
+	roles, err := enforcer.GetImplicitRolesForUser(subject)
+	if err != nil {
+		return nil
+	}
+	return roles
+}
+
+// callerAllowed reports whether the policy allows the caller action on
+// object, judged like the Authorize middleware: the API key account and,
+// for requests made on behalf of a user, the user must be allowed.
+func callerAllowed(c *gin.Context, enforcer *casbin.Enforcer, object, action string) bool {
+	if allowed, _ := enforcer.Enforce(c.GetString("api_key_user"), object, action); !allowed {
+		return false
+	}
+	if email, ok := c.Get("user_email"); ok {
+		allowed, _ := enforcer.Enforce(email, object, action)
+		return allowed
+	}
+	return true
+}
+
+// hasRole reports whether roles contains one of wanted.
+func hasRole(roles []string, wanted ...string) bool {
+	for _, role := range roles {
+		for _, w := range wanted {
+			if role == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// visibleOwners is the owner_id condition matching the exercises the caller
+// can see: the global catalog, which has no owner, and their own exercises.
+func visibleOwners(c *gin.Context) interface{} {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		return bson.M{"$exists": false}
+	}
+	return bson.M{"$in": []interface{}{nil, userID}}
+}
+
+// ownersFilter is the owner_id condition for an origin query parameter:
+// "global" for the shared catalog, "mine" for the caller's own exercises
+// and empty for both.
+func ownersFilter(c *gin.Context, origin string) (interface{}, error) {
+	switch origin {
+	case "":
+		return visibleOwners(c), nil
+	case "global":
+		return bson.M{"$exists": false}, nil
+	case "mine":
+		userID, err := userIDFromContext(c)
+		if err != nil {
+			return nil, err
+		}
+		return userID, nil
+	default:
+		return nil, errors.New("origin must be global or mine")
+	}
+}
+
+// exerciseVisible reports whether the caller can see an exercise.
+func exerciseVisible(c *gin.Context, exercise *models.Exercise) bool {
+	if exercise.OwnerID == nil {
+		return true
+	}
+	userID, err := userIDFromContext(c)
+	return err == nil && userID == *exercise.OwnerID
+}
+
+// checkExerciseWrite returns the status and message to respond with when
+// the caller may not change an exercise, or 0. Exercises of other users
+// are reported as not found so their existence is not revealed.
+func checkExerciseWrite(c *gin.Context, enforcer *casbin.Enforcer, exercise *models.Exercise) (int, string) {
+	if !exerciseVisible(c, exercise) {
+		return http.StatusNotFound, "Exercise not found"
+	}
+	if exercise.OwnerID == nil && !isAdmin(c, enforcer) {
+		return http.StatusForbidden, "Only admins can change the global catalog"
+	}
+	return 0, ""
+}
+
+// newExerciseOwner returns the owner of exercises created by the caller,
+// nil for the global catalog. origin defaults to "mine" for users and to
+// "global" for API key callers, and global exercises need the admin role.
+func newExerciseOwner(c *gin.Context, enforcer *casbin.Enforcer, origin string) (*primitive.ObjectID, int, error) {
+	userID, userErr := userIDFromContext(c)
+	if origin == "" {
+		origin = "mine"
+		if userErr != nil {
+			origin = "global"
+		}
+	}
+	switch origin {
+	case "global":
+		if !isAdmin(c, enforcer) {
+			return nil, http.StatusForbidden, errors.New("Only admins can add exercises to the global catalog")
+		}
+		return nil, 0, nil
+	case "mine":
+		if userErr != nil {
+			return nil, http.StatusUnauthorized, userErr
+		}
+		return &userID, 0, nil
+	default:
+		return nil, http.StatusBadRequest, errors.New("origin must be global or mine")
+	}
+}
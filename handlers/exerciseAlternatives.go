@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type alternativeResult struct {
+	Exercise      models.Exercise `json:"exercise"`
+	Score         float64         `json:"score"`
+	SharedMuscles []string        `json:"shared_muscles"`
+}
+
+// Alternatives ranks the other catalog exercises that can replace the given
+// one. Exercises can be left out by ID (exclude=) or by the equipment they
+// need (exclude_equipment=barbell,cable).
+func (h *ExerciseHandler) Alternatives(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	excluded := []primitive.ObjectID{objectID}
+	if exclude := c.Query("exclude"); exclude != "" {
+		for _, id := range strings.Split(exclude, ",") {
+			excludedID, err := primitive.ObjectIDFromHex(strings.TrimSpace(id))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exercise ID in exclude: " + id})
+				return
+			}
+			excluded = append(excluded, excludedID)
+		}
+	}
+	var excludedEquipment []string
+	if equipment := c.Query("exclude_equipment"); equipment != "" {
+		for _, item := range strings.Split(equipment, ",") {
+			known, ok := models.LookupEquipment(item)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown equipment: " + item})
+				return
+			}
+			excludedEquipment = append(excludedEquipment, known.ID)
+		}
+	}
+	limit := 10
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = n
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var target models.Exercise
+	owners := visibleOwners(c)
+	err = collection.FindOne(ctx, bson.M{"_id": objectID, "owner_id": owners}).Decode(&target)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	muscles := append(append([]string{}, target.PrimaryMuscleIDs...), target.SecondaryMuscleIDs...)
+	filter := bson.M{
+		"_id":      bson.M{"$nin": excluded},
+		"archived": bson.M{"$ne": true},
+		"owner_id": owners,
+		"$or": []bson.M{
+			{"primary_muscles": bson.M{"$in": muscles}},
+			{"secondary_muscles": bson.M{"$in": muscles}},
+		},
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var candidates []models.Exercise
+	if err := cursor.All(ctx, &candidates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := []alternativeResult{}
+	for _, candidate := range candidates {
+		if usesEquipment(candidate, excludedEquipment) {
+			continue
+		}
+		score, shared := alternativeScore(target, candidate)
+		if score > 0 {
+			results = append(results, alternativeResult{Exercise: candidate, Score: roundScore(score), SharedMuscles: shared})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// alternativeScore rates how well candidate can stand in for target, from 0
+// to 1. Muscle overlap makes up most of the score: a muscle that is primary
+// in both exercises counts fully, one that is primary in one and secondary
+// in the other counts a third. Matching Type and Focus add the rest.
+func alternativeScore(target, candidate models.Exercise) (float64, []string) {
+	weight := func(e models.Exercise, muscle string) float64 {
+		for _, id := range e.PrimaryMuscleIDs {
+			if id == muscle {
+				return 3
+			}
+		}
+		for _, id := range e.SecondaryMuscleIDs {
+			if id == muscle {
+				return 1
+			}
+		}
+		return 0
+	}
+
+	var overlap, possible float64
+	shared := []string{}
+	for _, muscle := range append(append([]string{}, target.PrimaryMuscleIDs...), target.SecondaryMuscleIDs...) {
+		targetWeight := weight(target, muscle)
+		possible += targetWeight
+		if candidateWeight := weight(candidate, muscle); candidateWeight > 0 {
+			overlap += min(targetWeight, candidateWeight)
+			shared = append(shared, muscle)
+		}
+	}
+	// Muscles the target does not work dilute the match
+	for _, muscle := range append(append([]string{}, candidate.PrimaryMuscleIDs...), candidate.SecondaryMuscleIDs...) {
+		if weight(target, muscle) == 0 {
+			possible += weight(candidate, muscle)
+		}
+	}
+	if overlap == 0 || possible == 0 {
+		return 0, shared
+	}
+
+	score := 0.7 * overlap / possible
+	if strings.EqualFold(target.Type, candidate.Type) {
+		score += 0.15
+	}
+	if strings.EqualFold(target.Focus, candidate.Focus) {
+		score += 0.15
+	}
+	return score, shared
+}
+
+// usesEquipment reports whether the exercise needs any of the given
+// equipment.
+func usesEquipment(exercise models.Exercise, equipment []string) bool {
+	for _, item := range equipment {
+		for _, used := range exercise.Equipment {
+			if used == item {
+				return true
+			}
+		}
+	}
+	return false
+}
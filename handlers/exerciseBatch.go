@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxBatchOperations = 1000
+
+// batchOperation is one operation of a batch. Policy applies to deletes as
+// with a single delete and defaults to the policy query parameter.
+type batchOperation struct {
+	Op       string           `json:"op"`
+	ID       string           `json:"id"`
+	Exercise *models.Exercise `json:"exercise"`
+	Policy   string           `json:"policy"`
+}
+
+type batchRequest struct {
+	// Atomic applies either every operation or none of them
+	Atomic     bool             `json:"atomic"`
+	Operations []batchOperation `json:"operations" binding:"required"`
+}
+
+type batchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Batch applies a list of create, update and delete operations on exercises
+// with a single bulk write and reports the outcome of each operation. In
+// atomic mode nothing is written unless every operation is valid, and the
+// writes run in a transaction.
+func (h *ExerciseHandler) Batch(c *gin.Context) {
+	var request batchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(request.Operations) == 0 || len(request.Operations) > maxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A batch must contain between 1 and %d operations", maxBatchOperations)})
+		return
+	}
+
+	policy := c.DefaultQuery("policy", "reject")
+	if policy != "reject" && policy != "archive" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "policy must be reject or archive"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	results := make([]batchResult, len(request.Operations))
+	ids := make([]primitive.ObjectID, len(request.Operations))
+	var targets []primitive.ObjectID
+	// seen maps the exercises changed by the batch to their operation
+	seen := make(map[primitive.ObjectID]int)
+	for i := range request.Operations {
+		operation := &request.Operations[i]
+		if operation.Op == "delete" && operation.Policy == "" {
+			operation.Policy = policy
+		}
+		results[i] = batchResult{Index: i, Op: operation.Op}
+		id, err := validateBatchOperation(*operation)
+		if err != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = err.Error()
+			continue
+		}
+		if first, ok := seen[id]; ok {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = fmt.Sprintf("Exercise is already changed by operation %d", first)
+			continue
+		}
+		seen[id] = i
+		// The route is reachable with any write action, so each operation
+		// needs its own
+		if !callerAllowed(c, h.Enforcer, "exercises", operation.Op) {
+			results[i].Status = http.StatusForbidden
+			results[i].Error = "Forbidden"
+			continue
+		}
+		ids[i] = id
+		if operation.Op != "create" {
+			targets = append(targets, id)
+		}
+	}
+
+	// Updates and deletes of exercises that do not exist are reported
+	// individually instead of being silently skipped by the bulk write. The
+	// stored versions are kept for the revision history.
+	existing, err := findExercises(ctx, collection, targets)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Created exercises are owned as with a single create, following the
+	// origin query parameter.
+	owner, ownerStatus, ownerErr := newExerciseOwner(c, h.Enforcer, c.Query("origin"))
+
+	var writes []mongo.WriteModel
+	var writeIndexes []int
+	failed := false
+	for i, operation := range request.Operations {
+		if results[i].Status != 0 {
+			failed = true
+			continue
+		}
+		if operation.Op != "create" {
+			stored, ok := existing[ids[i]]
+			status, message := http.StatusNotFound, "Exercise not found"
+			if ok {
+				status, message = checkExerciseWrite(c, h.Enforcer, &stored)
+			}
+			if status != 0 {
+				results[i].Status = status
+				results[i].Error = message
+				failed = true
+				continue
+			}
+		}
+		switch operation.Op {
+		case "create":
+			if ownerErr != nil {
+				results[i].Status = ownerStatus
+				results[i].Error = ownerErr.Error()
+				failed = true
+				continue
+			}
+			operation.Exercise.ID = ids[i]
+			operation.Exercise.OwnerID = owner
+			writes = append(writes, mongo.NewInsertOneModel().SetDocument(operation.Exercise))
+			results[i].Status = http.StatusCreated
+		case "update":
+			operation.Exercise.OwnerID = existing[ids[i]].OwnerID
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": ids[i]}).
+				SetUpdate(bson.M{"$set": operation.Exercise}))
+			results[i].Status = http.StatusOK
+		case "delete":
+			if operation.Policy == "archive" {
+				update := bson.M{"$set": bson.M{"archived": true, "archived_at": time.Now()}}
+				writes = append(writes, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": ids[i]}).SetUpdate(update))
+				results[i].Status = http.StatusOK
+				break
+			}
+			routines, err := referencingRoutines(ctx, h.DB, ids[i])
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if len(routines) > 0 {
+				results[i].Status = http.StatusConflict
+				results[i].Error = "Exercise is used by routines"
+				failed = true
+				continue
+			}
+			writes = append(writes, mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": ids[i]}))
+			results[i].Status = http.StatusOK
+		}
+		results[i].ID = ids[i].Hex()
+		writeIndexes = append(writeIndexes, i)
+	}
+
+	if request.Atomic && failed {
+		for _, i := range writeIndexes {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = "Not applied because another operation failed"
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"results": results})
+		return
+	}
+	if len(writes) == 0 {
+		c.JSON(http.StatusOK, gin.H{"results": results})
+		return
+	}
+
+	if request.Atomic {
+		err = h.bulkWriteInTransaction(ctx, collection, writes)
+	} else {
+		_, err = collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	}
+
+	var bulkErr mongo.BulkWriteException
+	switch {
+	case err == nil:
+	case request.Atomic:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	case errors.As(err, &bulkErr):
+		for _, writeErr := range bulkErr.WriteErrors {
+			i := writeIndexes[writeErr.Index]
+			results[i].Status = http.StatusInternalServerError
+			if mongo.IsDuplicateKeyError(writeErr) {
+				results[i].Status = http.StatusConflict
+			}
+			results[i].Error = writeErr.Message
+		}
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.recordBatchRevisions(ctx, c, request.Operations, results, ids, existing)
+	// Media files of deleted exercises are removed once the deletes are stored
+	for i, operation := range request.Operations {
+		if operation.Op == "delete" && operation.Policy != "archive" && results[i].Status == http.StatusOK {
+			for _, media := range existing[ids[i]].Media {
+				h.deleteMediaFiles(ctx, media)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// recordBatchRevisions records a revision for every operation that was
+// applied. Updated and archived exercises are read back to snapshot their
+// new state.
+func (h *ExerciseHandler) recordBatchRevisions(ctx context.Context, c *gin.Context, operations []batchOperation, results []batchResult, ids []primitive.ObjectID, before map[primitive.ObjectID]models.Exercise) {
+	var updated []primitive.ObjectID
+	for i, operation := range operations {
+		archived := operation.Op == "delete" && operation.Policy == "archive"
+		if (operation.Op == "update" || archived) && results[i].Status == http.StatusOK {
+			updated = append(updated, ids[i])
+		}
+	}
+	after, err := findExercises(ctx, h.DB.Database("gym-app").Collection("exercises"), updated)
+	if err != nil {
+		after = map[primitive.ObjectID]models.Exercise{}
+	}
+
+	for i, operation := range operations {
+		if results[i].Status != http.StatusOK && results[i].Status != http.StatusCreated {
+			continue
+		}
+		revision := models.ExerciseRevision{ExerciseID: ids[i], Action: operation.Op}
+		var previous *models.Exercise
+		if exercise, ok := before[ids[i]]; ok {
+			previous = &exercise
+		}
+		if operation.Op == "delete" && operation.Policy == "archive" {
+			revision.Action = "archive"
+		}
+		switch revision.Action {
+		case "create":
+			revision.Snapshot = operation.Exercise
+		case "update", "archive":
+			exercise, ok := after[ids[i]]
+			if !ok {
+				continue
+			}
+			revision.Snapshot = &exercise
+		}
+		recordRevision(ctx, c, h.DB, revision, previous)
+	}
+}
+
+// validateBatchOperation checks a single operation and returns the ID of
+// the exercise it acts on. New exercises get their ID here so it can be
+// reported back.
+func validateBatchOperation(operation batchOperation) (primitive.ObjectID, error) {
+	if operation.Op != "delete" && operation.Policy != "" {
+		return primitive.NilObjectID, errors.New("policy only applies to delete")
+	}
+	switch operation.Op {
+	case "create":
+		if operation.Exercise == nil {
+			return primitive.NilObjectID, errors.New("exercise is required")
+		}
+		if err := validateExercise(operation.Exercise); err != nil {
+			return primitive.NilObjectID, err
+		}
+		return primitive.NewObjectID(), nil
+	case "update", "delete":
+		id, err := primitive.ObjectIDFromHex(operation.ID)
+		if err != nil {
+			return primitive.NilObjectID, errors.New("Invalid ID format")
+		}
+		if operation.Op == "delete" {
+			if operation.Policy != "reject" && operation.Policy != "archive" {
+				return primitive.NilObjectID, errors.New("policy must be reject or archive")
+			}
+			return id, nil
+		}
+		if operation.Exercise == nil {
+			return primitive.NilObjectID, errors.New("exercise is required")
+		}
+		operation.Exercise.ID = primitive.NilObjectID
+		if err := validateExercise(operation.Exercise); err != nil {
+			return primitive.NilObjectID, err
+		}
+		return id, nil
+	default:
+		return primitive.NilObjectID, fmt.Errorf("unknown op %q, expected create, update or delete", operation.Op)
+	}
+}
+
+// validateExercise runs the same checks as a single create or update.
+func validateExercise(exercise *models.Exercise) error {
+	if err := binding.Validator.ValidateStruct(exercise); err != nil {
+		return err
+	}
+	return prepareExercise(exercise)
+}
+
+// findExercises loads the exercises with the given IDs, keyed by ID.
+func findExercises(ctx context.Context, collection *mongo.Collection, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Exercise, error) {
+	found := make(map[primitive.ObjectID]models.Exercise)
+	if len(ids) == 0 {
+		return found, nil
+	}
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var exercises []models.Exercise
+	if err := cursor.All(ctx, &exercises); err != nil {
+		return nil, err
+	}
+	for _, exercise := range exercises {
+		found[exercise.ID] = exercise
+	}
+	return found, nil
+}
+
+// existingExerciseIDs returns which of ids match filter.
+func existingExerciseIDs(ctx context.Context, collection *mongo.Collection, ids []primitive.ObjectID, filter bson.M) (map[primitive.ObjectID]bool, error) {
+	existing := make(map[primitive.ObjectID]bool)
+	if len(ids) == 0 {
+		return existing, nil
+	}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	query := bson.M{"_id": bson.M{"$in": ids}}
+	for key, value := range filter {
+		query[key] = value
+	}
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		existing[doc.ID] = true
+	}
+	return existing, nil
+}
+
+// bulkWriteInTransaction applies writes all-or-nothing. Transactions need
+// MongoDB to run as a replica set.
+func (h *ExerciseHandler) bulkWriteInTransaction(ctx context.Context, collection *mongo.Collection, writes []mongo.WriteModel) error {
+	session, err := h.DB.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return collection.BulkWrite(sessCtx, writes, options.BulkWrite().SetOrdered(true))
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type facetCount struct {
+	Value string `bson:"_id" json:"value"`
+	Name  string `bson:"-" json:"name,omitempty"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+type catalogFacets struct {
+	Total []struct {
+		Count int64 `bson:"count"`
+	} `bson:"total" json:"-"`
+	Focus     []facetCount `bson:"focus" json:"focus"`
+	Type      []facetCount `bson:"type" json:"type"`
+	Muscle    []facetCount `bson:"muscle" json:"muscle"`
+	Equipment []facetCount `bson:"equipment" json:"equipment"`
+}
+
+// Facets counts the exercises matching the GET /exercises filters per
+// Focus, Type, muscle and equipment, for showing next to filter options.
+// Each facet ignores its own filter, so that e.g. with ?focus=X the other
+// Focus values are still counted. An exercise counts once per muscle it
+// works, primary or secondary.
+func (h *ExerciseHandler) Facets(c *gin.Context) {
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := h.catalogFilter(ctx, c)
+	if !ok {
+		return
+	}
+
+	// The filters on a faceted field are applied to the other facets only,
+	// so that a filtered facet still counts its other values
+	type ownFilter struct {
+		facet string
+		match bson.M
+	}
+	var own []ownFilter
+	for _, facet := range []struct{ name, key string }{{"focus", "Focus"}, {"type", "Type"}, {"muscle", "$or"}} {
+		if condition, ok := filter[facet.key]; ok {
+			own = append(own, ownFilter{facet.name, bson.M{facet.key: condition}})
+			delete(filter, facet.key)
+		}
+	}
+	// Only the equipment parameter is the equipment facet's own filter, the
+	// available restriction applies to every facet
+	if equipment, ok := filter["equipment"].(bson.M); ok && equipment["$in"] != nil {
+		own = append(own, ownFilter{"equipment", bson.M{"equipment": bson.M{"$in": equipment["$in"]}}})
+		if available, ok := equipment["$not"]; ok {
+			filter["equipment"] = bson.M{"$not": available}
+		} else {
+			delete(filter, "equipment")
+		}
+	}
+	others := func(facet string) mongo.Pipeline {
+		var conditions []bson.M
+		for _, filter := range own {
+			if filter.facet != facet {
+				conditions = append(conditions, filter.match)
+			}
+		}
+		if len(conditions) == 0 {
+			return mongo.Pipeline{}
+		}
+		return mongo.Pipeline{{{Key: "$match", Value: bson.M{"$and": conditions}}}}
+	}
+
+	countBy := func(field string) mongo.Pipeline {
+		return mongo.Pipeline{
+			{{Key: "$group", Value: bson.M{"_id": field, "count": bson.M{"$sum": 1}}}},
+			{{Key: "$match", Value: bson.M{"_id": bson.M{"$nin": []interface{}{nil, ""}}}}},
+			{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		}
+	}
+	unwind := func(field string, expression interface{}) mongo.Pipeline {
+		return append(mongo.Pipeline{
+			{{Key: "$project", Value: bson.M{field: expression}}},
+			{{Key: "$unwind", Value: "$" + field}},
+		}, countBy("$"+field)...)
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.M{
+			"total": append(others(""), bson.D{{Key: "$count", Value: "count"}}),
+			"focus": append(others("focus"), countBy("$Focus")...),
+			"type":  append(others("type"), countBy("$Type")...),
+			"muscle": append(others("muscle"), unwind("muscle", bson.M{"$setUnion": bson.A{
+				bson.M{"$ifNull": bson.A{"$primary_muscles", bson.A{}}},
+				bson.M{"$ifNull": bson.A{"$secondary_muscles", bson.A{}}},
+			}})...),
+			"equipment": append(others("equipment"), unwind("equipment", bson.M{"$ifNull": bson.A{"$equipment", bson.A{}}})...),
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var results []catalogFacets
+	if err := cursor.All(ctx, &results); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	facets := catalogFacets{Focus: []facetCount{}, Type: []facetCount{}, Muscle: []facetCount{}, Equipment: []facetCount{}}
+	if len(results) > 0 {
+		facets = results[0]
+	}
+
+	var total int64
+	if len(facets.Total) > 0 {
+		total = facets.Total[0].Count
+	}
+	for i, count := range facets.Muscle {
+		if muscle, ok := models.LookupMuscle(count.Value); ok {
+			facets.Muscle[i].Name = muscle.Name
+		}
+	}
+	for i, count := range facets.Equipment {
+		if equipment, ok := models.LookupEquipment(count.Value); ok {
+			facets.Equipment[i].Name = equipment.Name
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "facets": facets})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gym-api/m/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Thresholds of fuzzy exercise name matching. A name resolves when its
+// best match scores at least minMatchScore and is clearly ahead of the
+// next exercise; otherwise the closest exercises are suggested like in
+// Search.
+const (
+	minMatchScore = 0.8
+	minMatchLead  = 0.05
+)
+
+// exerciseName is a name an exercise can be referred to by, in any locale.
+type exerciseName struct {
+	ID   primitive.ObjectID
+	Name string
+	key  string
+}
+
+// exerciseMatcher resolves exercise names written by people against the
+// catalog.
+type exerciseMatcher struct {
+	names []exerciseName
+}
+
+// newExerciseMatcher loads the names and translated names of the exercises
+// owner can use: the global catalog and their own exercises, without
+// archived ones.
+func newExerciseMatcher(ctx context.Context, client *mongo.Client, owner primitive.ObjectID) (*exerciseMatcher, error) {
+	collection := client.Database("gym-app").Collection("exercises")
+	filter := bson.M{"owner_id": bson.M{"$in": []interface{}{nil, owner}}, "archived": bson.M{"$ne": true}}
+	opts := options.Find().SetProjection(bson.M{"Exercise": 1, "translations": 1})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var exercises []models.Exercise
+	if err := cursor.All(ctx, &exercises); err != nil {
+		return nil, err
+	}
+	matcher := &exerciseMatcher{}
+	for _, exercise := range exercises {
+		matcher.add(exercise.ID, exercise.Exercise)
+		for _, translation := range exercise.Translations {
+			matcher.add(exercise.ID, translation.Name)
+		}
+	}
+	return matcher, nil
+}
+
+func (m *exerciseMatcher) add(id primitive.ObjectID, name string) {
+	if key := nameKey(name); key != "" {
+		m.names = append(m.names, exerciseName{ID: id, Name: name, key: key})
+	}
+}
+
+// has reports whether id is an exercise the matcher can resolve to.
+func (m *exerciseMatcher) has(id primitive.ObjectID) bool {
+	for _, name := range m.names {
+		if name.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// match resolves a name to an exercise. When it cannot, it returns the
+// names of the closest exercises as suggestions.
+func (m *exerciseMatcher) match(name string) (primitive.ObjectID, []string, bool) {
+	key := nameKey(name)
+	type scored struct {
+		exerciseName
+		score float64
+	}
+	best := make(map[primitive.ObjectID]scored)
+	for _, candidate := range m.names {
+		score := nameSimilarity(key, candidate.key)
+		if current, ok := best[candidate.ID]; !ok || score > current.score {
+			best[candidate.ID] = scored{candidate, score}
+		}
+	}
+	ranked := make([]scored, 0, len(best))
+	for _, candidate := range best {
+		ranked = append(ranked, candidate)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+
+	if len(ranked) > 0 && ranked[0].score >= minMatchScore &&
+		(len(ranked) == 1 || ranked[0].score-ranked[1].score >= minMatchLead) {
+		return ranked[0].ID, nil, true
+	}
+	suggestions := []string{}
+	for _, candidate := range ranked {
+		if candidate.score < minSuggestionScore || len(suggestions) == maxSuggestions {
+			break
+		}
+		suggestions = append(suggestions, candidate.Name)
+	}
+	return primitive.NilObjectID, suggestions, false
+}
+
+// nameKey normalizes a name for matching: lower case letters and digits
+// separated by single spaces.
+func nameKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// nameSimilarity scores two name keys from 0 to 1. Names with the same
+// words in another order score almost as high as equal names, and names
+// that contain all words of the other at least get suggested.
+func nameSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if sortedWords(a) == sortedWords(b) {
+		return 0.95
+	}
+	score := similarity(a, b)
+	if containsWords(a, b) || containsWords(b, a) {
+		score = max(score, minSuggestionScore)
+	}
+	return score
+}
+
+// containsWords reports whether every word of b is a word of a.
+func containsWords(a, b string) bool {
+	words := strings.Fields(a)
+	for _, word := range strings.Fields(b) {
+		if !slices.Contains(words, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedWords(key string) string {
+	words := strings.Fields(key)
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
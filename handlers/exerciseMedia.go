@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxMediaPerExercise = 10
+	thumbnailSize       = 320
+	maxCaptionLength    = 200
+	// maxImagePixels caps the dimensions of decoded images, since a small
+	// file can declare a huge image.
+	maxImagePixels = 40_000_000
+)
+
+type mediaType struct {
+	kind    string
+	maxSize int64
+}
+
+// mediaTypes lists the accepted upload formats by sniffed content type,
+// with their size limit.
+var mediaTypes = map[string]mediaType{
+	"image/jpeg":      {kind: "image", maxSize: 5 << 20},
+	"image/png":       {kind: "image", maxSize: 5 << 20},
+	"image/webp":      {kind: "image", maxSize: 5 << 20},
+	"image/gif":       {kind: "gif", maxSize: 10 << 20},
+	"video/mp4":       {kind: "video", maxSize: 50 << 20},
+	"video/webm":      {kind: "video", maxSize: 50 << 20},
+	"video/quicktime": {kind: "video", maxSize: 50 << 20},
+}
+
+// maxUploadSize bounds the whole multipart request: the largest file plus
+// room for the other form fields.
+const maxUploadSize = 50<<20 + 1<<20
+
+// UploadMedia attaches an image, GIF or video sent as the "file" field of
+// a multipart form, with an optional "caption" field. The format is
+// sniffed from the content; the file name and declared type are ignored.
+func (h *ExerciseHandler) UploadMedia(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	exercise, ok := h.writableExercise(ctx, c, objectID)
+	if !ok {
+		return
+	}
+	if len(exercise.Media) >= maxMediaPerExercise {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("An exercise can have at most %d media files", maxMediaPerExercise)})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload is too large"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required in the file field: " + err.Error()})
+		}
+		return
+	}
+	defer file.Close()
+
+	caption := strings.TrimSpace(c.PostForm("caption"))
+	if len(caption) > maxCaptionLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("caption must be at most %d characters", maxCaptionLength)})
+		return
+	}
+
+	detected, err := mimetype.DetectReader(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	contentType, _, _ := strings.Cut(detected.String(), ";")
+	format, ok := mediaTypes[contentType]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported media type " + contentType})
+		return
+	}
+	if header.Size > format.maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s files must be at most %d MB", format.kind, format.maxSize>>20)})
+		return
+	}
+
+	media := models.Media{
+		ID:          primitive.NewObjectID(),
+		Kind:        format.kind,
+		ContentType: contentType,
+		Size:        header.Size,
+		Caption:     caption,
+		UploadedBy:  actorFromContext(c),
+		UploadedAt:  time.Now(),
+	}
+	prefix := fmt.Sprintf("exercises/%s/%s", objectID.Hex(), media.ID.Hex())
+	media.Key = prefix + detected.Extension()
+	media.URL = h.Storage.URL(media.Key)
+
+	var content io.Reader = file
+	var thumbnail []byte
+	if format.kind != "video" {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		content = bytes.NewReader(data)
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil && config.Width*config.Height > maxImagePixels {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Images must be at most %d megapixels", maxImagePixels/1_000_000)})
+			return
+		}
+		// Formats the standard library cannot decode, such as WebP, are
+		// stored without dimensions or thumbnail.
+		if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			bounds := img.Bounds()
+			media.Width, media.Height = bounds.Dx(), bounds.Dy()
+			thumb := scaleDown(img, thumbnailSize)
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err == nil {
+				thumbnail = buf.Bytes()
+				media.Thumbnail = &models.Thumbnail{
+					Key:    prefix + "_thumb.jpg",
+					Width:  thumb.Bounds().Dx(),
+					Height: thumb.Bounds().Dy(),
+				}
+				media.Thumbnail.URL = h.Storage.URL(media.Thumbnail.Key)
+			}
+		}
+	}
+
+	if err := h.Storage.Save(ctx, media.Key, content); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if media.Thumbnail != nil {
+		if err := h.Storage.Save(ctx, media.Thumbnail.Key, bytes.NewReader(thumbnail)); err != nil {
+			h.deleteMediaFiles(ctx, media)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// The limit is checked again when pushing, since other uploads may have
+	// been stored in the meantime
+	filter := bson.M{"_id": objectID, fmt.Sprintf("media.%d", maxMediaPerExercise-1): bson.M{"$exists": false}}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"media": media}})
+	if err != nil || result.MatchedCount == 0 {
+		h.deleteMediaFiles(ctx, media)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		} else if count, err := collection.CountDocuments(ctx, bson.M{"_id": objectID}); err == nil && count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("An exercise can have at most %d media files", maxMediaPerExercise)})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, media)
+}
+
+func (h *ExerciseHandler) GetMedia(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var exercise models.Exercise
+	filter := bson.M{"_id": objectID, "owner_id": visibleOwners(c)}
+	err = collection.FindOne(ctx, filter).Decode(&exercise)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	media := exercise.Media
+	if media == nil {
+		media = []models.Media{}
+	}
+	c.JSON(http.StatusOK, media)
+}
+
+// DeleteMedia detaches a media file from an exercise and removes it and
+// its thumbnail from storage.
+func (h *ExerciseHandler) DeleteMedia(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	mediaID, err := primitive.ObjectIDFromHex(c.Param("mediaId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID format"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exercise, ok := h.writableExercise(ctx, c, objectID)
+	if !ok {
+		return
+	}
+	var media *models.Media
+	for i := range exercise.Media {
+		if exercise.Media[i].ID == mediaID {
+			media = &exercise.Media[i]
+		}
+	}
+	if media == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	update := bson.M{"$pull": bson.M{"media": bson.M{"id": mediaID}}}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, update); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.deleteMediaFiles(ctx, *media)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Media deleted"})
+}
+
+// writableExercise loads an exercise the caller may change. It writes an
+// error response and returns false otherwise.
+func (h *ExerciseHandler) writableExercise(ctx context.Context, c *gin.Context, objectID primitive.ObjectID) (*models.Exercise, bool) {
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	var exercise models.Exercise
+	err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&exercise)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	if status, message := checkExerciseWrite(c, h.Enforcer, &exercise); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return nil, false
+	}
+	return &exercise, true
+}
+
+// deleteMediaFiles removes a media file and its thumbnail from storage.
+// Failures only leave orphaned files behind, so they are logged.
+func (h *ExerciseHandler) deleteMediaFiles(ctx context.Context, media models.Media) {
+	keys := []string{media.Key}
+	if media.Thumbnail != nil {
+		keys = append(keys, media.Thumbnail.Key)
+	}
+	for _, key := range keys {
+		if err := h.Storage.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete media file %s: %v", key, err)
+		}
+	}
+}
+
+// scaleDown returns img resized to fit in a size x size square, averaging
+// the source pixels covered by each target pixel. Smaller images are
+// returned as they are.
+func scaleDown(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	targetWidth, targetHeight := size, height*size/width
+	if height > width {
+		targetWidth, targetHeight = width*size/height, size
+	}
+	targetWidth, targetHeight = max(targetWidth, 1), max(targetHeight, 1)
+
+	thumb := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	for y := 0; y < targetHeight; y++ {
+		y0 := bounds.Min.Y + y*height/targetHeight
+		y1 := max(bounds.Min.Y+(y+1)*height/targetHeight, y0+1)
+		for x := 0; x < targetWidth; x++ {
+			x0 := bounds.Min.X + x*width/targetWidth
+			x1 := max(bounds.Min.X+(x+1)*width/targetWidth, x0+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			offset := thumb.PixOffset(x, y)
+			thumb.Pix[offset] = uint8(r / n >> 8)
+			thumb.Pix[offset+1] = uint8(g / n >> 8)
+			thumb.Pix[offset+2] = uint8(b / n >> 8)
+			thumb.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+	return thumb
+}
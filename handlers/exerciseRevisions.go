@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type fieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// GetRevisions lists the revisions of an exercise, newest first. Revisions
+// are kept after the exercise is deleted so it can be restored.
+func (h *ExerciseHandler) GetRevisions(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercise_revisions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}})
+	cursor, err := collection.Find(ctx, bson.M{"exercise_id": objectID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []models.ExerciseRevision{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(revisions) == 0 || !h.historyVisible(ctx, c, objectID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No revisions found for exercise"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+func (h *ExerciseHandler) GetRevision(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	number, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision number"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revision, err := findRevision(ctx, h.DB, objectID, number)
+	if err == nil && !h.historyVisible(ctx, c, objectID) {
+		err = mongo.ErrNoDocuments
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// DiffRevisions compares the snapshots of two revisions field by field.
+// to defaults to the latest revision and from to the one before it.
+func (h *ExerciseHandler) DiffRevisions(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !h.historyVisible(ctx, c, objectID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No revisions found for exercise"})
+		return
+	}
+
+	to := 0
+	if value := c.Query("to"); value != "" {
+		if to, err = strconv.Atoi(value); err != nil || to < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a revision number"})
+			return
+		}
+	} else {
+		if to, err = latestRevision(ctx, h.DB, objectID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	from := to - 1
+	if value := c.Query("from"); value != "" {
+		if from, err = strconv.Atoi(value); err != nil || from < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a revision number"})
+			return
+		}
+	}
+
+	var snapshots [2]*models.Exercise
+	for i, number := range []int{from, to} {
+		revision, err := findRevision(ctx, h.DB, objectID, number)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Revision " + strconv.Itoa(number) + " not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		snapshots[i] = revision.Snapshot
+	}
+
+	changes, err := diffExercises(snapshots[0], snapshots[1])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "changes": changes})
+}
+
+// RevertRevision restores the snapshot of a revision, recreating the
+// exercise if it was deleted since. The revert is recorded as a new
+// revision, so it can itself be reverted.
+func (h *ExerciseHandler) RevertRevision(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	number, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision number"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revision, err := findRevision(ctx, h.DB, objectID, number)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if revision.Snapshot == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Revision is a deletion and has no snapshot to restore"})
+		return
+	}
+	if status, message := checkExerciseWrite(c, h.Enforcer, revision.Snapshot); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	// Media files are not versioned, so the current media is kept, and
+	// neither is archiving, which only the delete policy changes
+	var current models.Exercise
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&current)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	exercise := *revision.Snapshot
+	exercise.ID = objectID
+	exercise.Media = current.Media
+	exercise.Archived, exercise.ArchivedAt = current.Archived, current.ArchivedAt
+	opts := options.Replace().SetUpsert(true)
+	if _, err := collection.ReplaceOne(ctx, bson.M{"_id": objectID}, exercise, opts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordRevision(ctx, c, h.DB, models.ExerciseRevision{
+		ExerciseID:   objectID,
+		Action:       "revert",
+		Snapshot:     &exercise,
+		RevertedFrom: number,
+	}, nil)
+
+	c.JSON(http.StatusOK, exercise)
+}
+
+// recordRevision appends a revision to the history of an exercise, filling
+// in its number, author and time. before is the stored exercise prior to
+// the change; exercises that predate revision history get it recorded as a
+// baseline first so the change can be diffed and reverted. Failures are
+// logged rather than returned since the exercise itself was already written.
+func recordRevision(ctx context.Context, c *gin.Context, client *mongo.Client, revision models.ExerciseRevision, before *models.Exercise) {
+	collection := client.Database("gym-app").Collection("exercise_revisions")
+
+	latest, err := latestRevision(ctx, client, revision.ExerciseID)
+	if err != nil {
+		log.Printf("Failed to record revision of exercise %s: %v", revision.ExerciseID.Hex(), err)
+		return
+	}
+	if latest == 0 && before != nil {
+		baseline := models.ExerciseRevision{
+			ExerciseID: revision.ExerciseID,
+			Revision:   1,
+			Action:     "baseline",
+			Snapshot:   before,
+			ChangedAt:  time.Now(),
+		}
+		if _, err := collection.InsertOne(ctx, baseline); err != nil && !mongo.IsDuplicateKeyError(err) {
+			log.Printf("Failed to record revision of exercise %s: %v", revision.ExerciseID.Hex(), err)
+			return
+		}
+		latest = 1
+	}
+
+	revision.ChangedBy = actorFromContext(c)
+	revision.ChangedAt = time.Now()
+	// A concurrent change may take the same number; the unique index on
+	// exercise_id and revision rejects it and the next number is tried.
+	for attempt := 0; attempt < 3; attempt++ {
+		revision.Revision = latest + 1 + attempt
+		_, err = collection.InsertOne(ctx, revision)
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to record revision of exercise %s: %v", revision.ExerciseID.Hex(), err)
+	}
+}
+
+// historyVisible reports whether the caller can see the history of an
+// exercise, judged by its latest snapshot since the exercise itself may
+// have been deleted.
+func (h *ExerciseHandler) historyVisible(ctx context.Context, c *gin.Context, exerciseID primitive.ObjectID) bool {
+	collection := h.DB.Database("gym-app").Collection("exercise_revisions")
+	opts := options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}})
+	filter := bson.M{"exercise_id": exerciseID, "snapshot": bson.M{"$exists": true}}
+	var revision models.ExerciseRevision
+	if err := collection.FindOne(ctx, filter, opts).Decode(&revision); err != nil {
+		return err == mongo.ErrNoDocuments
+	}
+	return exerciseVisible(c, revision.Snapshot)
+}
+
+func findRevision(ctx context.Context, client *mongo.Client, exerciseID primitive.ObjectID, number int) (*models.ExerciseRevision, error) {
+	collection := client.Database("gym-app").Collection("exercise_revisions")
+	var revision models.ExerciseRevision
+	err := collection.FindOne(ctx, bson.M{"exercise_id": exerciseID, "revision": number}).Decode(&revision)
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// latestRevision returns the highest revision number of an exercise, or 0
+// when it has no history.
+func latestRevision(ctx context.Context, client *mongo.Client, exerciseID primitive.ObjectID) (int, error) {
+	collection := client.Database("gym-app").Collection("exercise_revisions")
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "revision", Value: -1}}).
+		SetProjection(bson.M{"revision": 1})
+	var revision models.ExerciseRevision
+	err := collection.FindOne(ctx, bson.M{"exercise_id": exerciseID}, opts).Decode(&revision)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return revision.Revision, nil
+}
+
+// diffExercises lists the JSON fields that differ between two snapshots. A
+// nil snapshot stands for a deleted exercise and has no fields.
+func diffExercises(from, to *models.Exercise) ([]fieldChange, error) {
+	before, err := snapshotFields(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := snapshotFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	delete(names, "id")
+
+	changes := []fieldChange{}
+	for name := range names {
+		if !reflect.DeepEqual(before[name], after[name]) {
+			changes = append(changes, fieldChange{Field: name, From: before[name], To: after[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+func snapshotFields(exercise *models.Exercise) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if exercise == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(exercise)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
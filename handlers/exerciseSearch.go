@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/antlabs/strsim"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// minSearchScore is the relevance below which an exercise is not
+	// considered a match.
+	minSearchScore = 0.6
+	// minSuggestionScore is the similarity a name needs to be offered as a
+	// "did you mean" suggestion.
+	minSuggestionScore = 0.4
+	maxSuggestions     = 3
+	// maxSearchCandidates caps how much of the catalog a search scores
+	// besides the text matches.
+	maxSearchCandidates = 5000
+)
+
+type searchResult struct {
+	Exercise models.Exercise `json:"exercise"`
+	Score    float64         `json:"score"`
+}
+
+// Search ranks exercises by how well their name and muscles match the q
+// parameter. Mongo's text index catches exact and stemmed words while
+// string similarity tolerates typos such as "latt pulldown".
+func (h *ExerciseHandler) Search(c *gin.Context) {
+	q := strings.Join(strings.Fields(c.Query("q")), " ")
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+	limit := 20
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = n
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Exercises are scored on their name and muscles only, and the full
+	// documents are loaded for the results alone.
+	owners := visibleOwners(c)
+	scored := bson.M{"Exercise": 1, "primary_muscles": 1, "secondary_muscles": 1}
+
+	// Text scores are only used as a bonus on top of the similarity score.
+	textProjection := bson.M{"score": bson.M{"$meta": "textScore"}}
+	for field := range scored {
+		textProjection[field] = 1
+	}
+	textOpts := options.Find().
+		SetProjection(textProjection).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(100)
+	textFilter := bson.M{"$text": bson.M{"$search": q}, "archived": bson.M{"$ne": true}, "owner_id": owners}
+	cursor, err := collection.Find(ctx, textFilter, textOpts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var textMatches []struct {
+		models.Exercise `bson:",inline"`
+		Score           float64 `bson:"score"`
+	}
+	if err := cursor.All(ctx, &textMatches); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	textScores := make(map[primitive.ObjectID]float64)
+	maxTextScore := 0.0
+	var exercises []models.Exercise
+	textIDs := []primitive.ObjectID{}
+	for _, match := range textMatches {
+		textScores[match.ID] = match.Score
+		if match.Score > maxTextScore {
+			maxTextScore = match.Score
+		}
+		exercises = append(exercises, match.Exercise)
+		textIDs = append(textIDs, match.ID)
+	}
+
+	// Text matches are always scored; the rest of the catalog only up to
+	// maxSearchCandidates exercises.
+	catalogFilter := bson.M{"_id": bson.M{"$nin": textIDs}, "archived": bson.M{"$ne": true}, "owner_id": owners}
+	catalogOpts := options.Find().SetProjection(scored).SetLimit(maxSearchCandidates)
+	cursor, err = collection.Find(ctx, catalogFilter, catalogOpts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var catalog []models.Exercise
+	if err := cursor.All(ctx, &catalog); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	exercises = append(exercises, catalog...)
+
+	queryTokens := strings.Fields(strings.ToLower(q))
+	results := []searchResult{}
+	for _, exercise := range exercises {
+		score := searchScore(q, queryTokens, exercise)
+		if maxTextScore > 0 {
+			score += 0.2 * textScores[exercise.ID] / maxTextScore
+		}
+		if score > 1 {
+			score = 1
+		}
+		if score >= minSearchScore {
+			results = append(results, searchResult{Exercise: exercise, Score: roundScore(score)})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	if !loadSearchResults(ctx, c, collection, results) {
+		return
+	}
+
+	response := gin.H{"query": q, "results": results}
+	if len(results) == 0 {
+		response["suggestions"] = suggestNames(q, exercises)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// loadSearchResults replaces the scored fields of the results with the
+// full exercises. It writes an error response and returns false when they
+// cannot be loaded.
+func loadSearchResults(ctx context.Context, c *gin.Context, collection *mongo.Collection, results []searchResult) bool {
+	if len(results) == 0 {
+		return true
+	}
+	ids := make([]primitive.ObjectID, len(results))
+	for i, result := range results {
+		ids[i] = result.Exercise.ID
+	}
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	var exercises []models.Exercise
+	if err := cursor.All(ctx, &exercises); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	byID := make(map[primitive.ObjectID]models.Exercise, len(exercises))
+	for _, exercise := range exercises {
+		byID[exercise.ID] = exercise
+	}
+	for i := range results {
+		if exercise, ok := byID[results[i].Exercise.ID]; ok {
+			results[i].Exercise = exercise
+		}
+	}
+	return true
+}
+
+// searchScore combines the similarity of the whole query to the exercise
+// name with the best per-word matches against the name and muscle names.
+func searchScore(q string, queryTokens []string, exercise models.Exercise) float64 {
+	nameTokens := strings.Fields(strings.ToLower(exercise.Exercise))
+	primaryTokens := muscleTokens(exercise.PrimaryMuscleIDs)
+	secondaryTokens := muscleTokens(exercise.SecondaryMuscleIDs)
+
+	tokenScore := 0.0
+	for _, token := range queryTokens {
+		best := 0.0
+		for _, name := range nameTokens {
+			best = max(best, similarity(token, name))
+		}
+		// Muscle matches are worth less than name matches
+		for _, muscle := range primaryTokens {
+			best = max(best, 0.8*similarity(token, muscle))
+		}
+		for _, muscle := range secondaryTokens {
+			best = max(best, 0.6*similarity(token, muscle))
+		}
+		tokenScore += best
+	}
+	tokenScore /= float64(len(queryTokens))
+
+	return 0.7*tokenScore + 0.3*similarity(q, exercise.Exercise)
+}
+
+func muscleTokens(ids []string) []string {
+	var tokens []string
+	for _, id := range ids {
+		if muscle, ok := models.LookupMuscle(id); ok {
+			tokens = append(tokens, strings.Fields(strings.ToLower(muscle.Name))...)
+		}
+	}
+	return tokens
+}
+
+// suggestNames returns the exercise names closest to q.
+func suggestNames(q string, exercises []models.Exercise) []string {
+	type candidate struct {
+		name  string
+		score float64
+	}
+	var candidates []candidate
+	for _, exercise := range exercises {
+		score := similarity(q, exercise.Exercise)
+		if score >= minSuggestionScore {
+			candidates = append(candidates, candidate{name: exercise.Exercise, score: score})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	suggestions := []string{}
+	for _, candidate := range candidates {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+		suggestions = append(suggestions, candidate.name)
+	}
+	return suggestions
+}
+
+func similarity(a, b string) float64 {
+	return strsim.Compare(a, b, strsim.IgnoreCase())
+}
+
+func roundScore(score float64) float64 {
+	return float64(int(score*1000+0.5)) / 1000
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type missingTranslation struct {
+	ID       primitive.ObjectID `json:"id"`
+	Exercise string             `json:"Exercise"`
+	Missing  []string           `json:"missing"`
+}
+
+// UpsertTranslation sets the translation of an exercise for one locale,
+// replacing any previous translation for that locale.
+func (h *ExerciseHandler) UpsertTranslation(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	locale, err := translationLocale(c.Param("lang"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var translation models.ExerciseTranslation
+	if err := c.ShouldBindJSON(&translation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := resolveTranslation(&translation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var before models.Exercise
+	update := bson.M{"$set": bson.M{"translations." + locale: translation}}
+	// Private exercises are not translated
+	filter := bson.M{"_id": objectID, "owner_id": bson.M{"$exists": false}}
+	err = collection.FindOneAndUpdate(ctx, filter, update).Decode(&before)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	after := before
+	after.Translations = make(map[string]models.ExerciseTranslation)
+	for key, value := range before.Translations {
+		after.Translations[key] = value
+	}
+	after.Translations[locale] = translation
+	recordRevision(ctx, c, h.DB, models.ExerciseRevision{ExerciseID: objectID, Action: "update", Snapshot: &after}, &before)
+
+	c.JSON(http.StatusOK, translation)
+}
+
+// GetMissingTranslations lists the catalog exercises whose translation for
+// the lang locale is missing or incomplete, with the fields still to do.
+func (h *ExerciseHandler) GetMissingTranslations(c *gin.Context) {
+	locale, err := translationLocale(c.Query("lang"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "Exercise", Value: 1}})
+	filter := bson.M{"archived": bson.M{"$ne": true}, "owner_id": bson.M{"$exists": false}}
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var exercises []models.Exercise
+	if err := cursor.All(ctx, &exercises); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := []missingTranslation{}
+	for _, exercise := range exercises {
+		translation := exercise.Translations[locale]
+		var missing []string
+		if translation.Name == "" {
+			missing = append(missing, "name")
+		}
+		if len(exercise.Instructions) > 0 && len(translation.Instructions) == 0 {
+			missing = append(missing, "instructions")
+		}
+		if len(exercise.Cues) > 0 && len(translation.Cues) == 0 {
+			missing = append(missing, "cues")
+		}
+		if len(exercise.Mistakes) > 0 && len(translation.Mistakes) == 0 {
+			missing = append(missing, "mistakes")
+		}
+		for _, ids := range [][]string{exercise.PrimaryMuscleIDs, exercise.SecondaryMuscleIDs} {
+			for _, id := range ids {
+				if translation.Muscles[id] == "" {
+					missing = append(missing, "muscles."+id)
+				}
+			}
+		}
+		if len(missing) > 0 {
+			results = append(results, missingTranslation{ID: exercise.ID, Exercise: exercise.Exercise, Missing: missing})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lang": locale, "count": len(results), "exercises": results})
+}
+
+// translationLocale checks that lang is a supported locale other than the
+// default one, whose text lives on the exercise itself.
+func translationLocale(lang string) (string, error) {
+	if lang == "" {
+		return "", errors.New("lang is required")
+	}
+	locale, ok := models.LookupLocale(lang)
+	if !ok {
+		return "", fmt.Errorf("Unsupported language: %s, supported languages are: %s", lang, strings.Join(models.Locales, ", "))
+	}
+	if locale == models.DefaultLocale {
+		return "", fmt.Errorf("%s is the default language, edit the exercise itself instead", locale)
+	}
+	return locale, nil
+}
+
+// resolveTranslations validates the translations sent with an exercise.
+func resolveTranslations(exercise *models.Exercise) error {
+	if len(exercise.Translations) == 0 {
+		return nil
+	}
+	translations := make(map[string]models.ExerciseTranslation, len(exercise.Translations))
+	for lang, translation := range exercise.Translations {
+		locale, err := translationLocale(lang)
+		if err != nil {
+			return err
+		}
+		if translation.Name == "" {
+			return fmt.Errorf("translations.%s.name is required", lang)
+		}
+		if err := resolveTranslation(&translation); err != nil {
+			return err
+		}
+		translations[locale] = translation
+	}
+	exercise.Translations = translations
+	return nil
+}
+
+// resolveTranslation cleans up the text lists of a translation and
+// canonicalizes the muscle IDs it names.
+func resolveTranslation(translation *models.ExerciseTranslation) error {
+	var err error
+	if translation.Instructions, err = cleanContentList("instructions", translation.Instructions); err != nil {
+		return err
+	}
+	if translation.Cues, err = cleanContentList("cues", translation.Cues); err != nil {
+		return err
+	}
+	if translation.Mistakes, err = cleanContentList("mistakes", translation.Mistakes); err != nil {
+		return err
+	}
+	if len(translation.Muscles) == 0 {
+		return nil
+	}
+	muscles := make(map[string]string, len(translation.Muscles))
+	for id, name := range translation.Muscles {
+		muscle, ok := models.LookupMuscle(id)
+		if !ok {
+			return fmt.Errorf("unknown muscle: %s", id)
+		}
+		muscles[muscle.ID] = name
+	}
+	translation.Muscles = muscles
+	return nil
+}
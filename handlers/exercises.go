@@ -2,11 +2,17 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"gym-api/m/models"
+	"gym-api/m/storage"
 
+	"github.com/casbin/casbin/v2"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -14,44 +20,152 @@ import (
 )
 
 type ExerciseHandler struct {
-	DB *mongo.Client
+	DB       *mongo.Client
+	Enforcer *casbin.Enforcer
+	Storage  storage.Storage
 }
 
 func (h *ExerciseHandler) GetAll(c *gin.Context) {
+	query, err := parseListQuery(c, models.Exercise{}, "Exercise", "Type", "Focus")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	locale, err := requestLocale(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Translations are needed to localize whichever fields are requested
+	query.load("translations")
+
 	collection := h.DB.Database("gym-app").Collection("exercises")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Build filter from query parameters
-	filter := bson.M{}
+	filter, ok := h.catalogFilter(ctx, c)
+	if !ok {
+		return
+	}
+
+	var exercises []models.Exercise
+	if err := findPage(ctx, c, collection, filter, query, &exercises); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range exercises {
+		localizeExercise(&exercises[i], locale)
+	}
+
+	response, err := query.project(exercises)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// catalogFilter builds the exercise filter shared by the catalog list and
+// its facets from the query parameters. It writes an error response and
+// returns false when a parameter is invalid.
+func (h *ExerciseHandler) catalogFilter(ctx context.Context, c *gin.Context) (bson.M, bool) {
+	owners, err := ownersFilter(c, c.Query("origin"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	filter := bson.M{"owner_id": owners}
+	if c.Query("include_archived") != "true" {
+		filter["archived"] = bson.M{"$ne": true}
+	}
 	if focus := c.Query("focus"); focus != "" {
 		filter["Focus"] = bson.M{"$regex": focus, "$options": "i"}
 	}
 	if exerciseType := c.Query("type"); exerciseType != "" {
 		filter["Type"] = bson.M{"$regex": exerciseType, "$options": "i"}
 	}
-	if muscle := c.Query("muscle"); muscle != "" {
+	if name := c.Query("muscle"); name != "" {
+		muscle, ok := models.LookupMuscle(name)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown muscle: " + name})
+			return nil, false
+		}
 		filter["$or"] = []bson.M{
-			{"Primary Muscles": bson.M{"$regex": muscle, "$options": "i"}},
-			{"Secondary Muscles": bson.M{"$regex": muscle, "$options": "i"}},
+			{"primary_muscles": muscle.ID},
+			{"secondary_muscles": muscle.ID},
 		}
 	}
-
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	// Content attributes take comma separated lists of allowed values
+	enumFilters := []struct {
+		field   string
+		allowed []string
+	}{
+		{"difficulty", models.Difficulties},
+		{"movement_pattern", models.MovementPatterns},
+		{"laterality", models.Lateralities},
+		{"force_type", models.ForceTypes},
 	}
-	defer cursor.Close(ctx)
-
-	var exercises []models.Exercise
-	if err := cursor.All(ctx, &exercises); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	for _, enum := range enumFilters {
+		param := c.Query(enum.field)
+		if param == "" {
+			continue
+		}
+		var values []string
+		for _, value := range strings.Split(param, ",") {
+			value, err := enumValue(enum.field, value, enum.allowed)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return nil, false
+			}
+			values = append(values, value)
+		}
+		filter[enum.field] = bson.M{"$in": values}
+	}
+	// has_instructions, has_cues and has_mistakes take true or false
+	for _, field := range []string{"instructions", "cues", "mistakes"} {
+		param := c.Query("has_" + field)
+		if param == "" {
+			continue
+		}
+		has, err := strconv.ParseBool(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("has_%s must be true or false", field)})
+			return nil, false
+		}
+		filter[field+".0"] = bson.M{"$exists": has}
+	}
+	equipmentFilter := bson.M{}
+	if equipment := c.Query("equipment"); equipment != "" {
+		ids, err := resolveEquipment(strings.Split(equipment, ","))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		equipmentFilter["$in"] = ids
+	}
+	// Restrict to exercises the caller can do with their own equipment
+	if c.Query("available") == "true" {
+		userID, err := userIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		// Callers without a user document, e.g. one deleted after the token
+		// was issued, have no equipment of their own
+		available, err := availableEquipment(ctx, h.DB, userID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		available = append(available, "bodyweight")
+		equipmentFilter["$not"] = bson.M{"$elemMatch": bson.M{"$nin": available}}
+	}
+	if len(equipmentFilter) > 0 {
+		filter["equipment"] = equipmentFilter
 	}
 
-	c.JSON(http.StatusOK, exercises)
+	return filter, true
 }
 
 func (h *ExerciseHandler) GetByID(c *gin.Context) {
@@ -61,6 +175,11 @@ func (h *ExerciseHandler) GetByID(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	locale, err := requestLocale(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	collection := h.DB.Database("gym-app").Collection("exercises")
 
@@ -68,7 +187,8 @@ func (h *ExerciseHandler) GetByID(c *gin.Context) {
 	defer cancel()
 
 	var exercise models.Exercise
-	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&exercise)
+	filter := bson.M{"_id": objectID, "owner_id": visibleOwners(c)}
+	err = collection.FindOne(ctx, filter).Decode(&exercise)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
@@ -77,6 +197,7 @@ func (h *ExerciseHandler) GetByID(c *gin.Context) {
 		}
 		return
 	}
+	localizeExercise(&exercise, locale)
 
 	c.JSON(http.StatusOK, exercise)
 }
@@ -93,16 +214,28 @@ func (h *ExerciseHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON or missing required fields: " + err.Error()})
 		return
 	}
+	if err := prepareExercise(&exercise); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	owner, status, err := newExerciseOwner(c, h.Enforcer, c.Query("origin"))
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	exercise.OwnerID = owner
 
 	collection := h.DB.Database("gym-app").Collection("exercises")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	exercise.ID = primitive.NewObjectID()
 	result, err := collection.InsertOne(ctx, exercise)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordRevision(ctx, c, h.DB, models.ExerciseRevision{ExerciseID: exercise.ID, Action: "create", Snapshot: &exercise}, nil)
 
 	c.JSON(http.StatusCreated, gin.H{"id": result.InsertedID})
 }
@@ -119,11 +252,32 @@ func (h *ExerciseHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := prepareExercise(&exercise); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	collection := h.DB.Database("gym-app").Collection("exercises")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var before, after models.Exercise
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&before)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if status, message := checkExerciseWrite(c, h.Enforcer, &before); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	exercise.OwnerID = before.OwnerID
+	exercise.Archived, exercise.ArchivedAt = before.Archived, before.ArchivedAt
+
 	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": exercise})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -133,10 +287,85 @@ func (h *ExerciseHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
 		return
 	}
+	if err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&after); err == nil {
+		recordRevision(ctx, c, h.DB, models.ExerciseRevision{ExerciseID: objectID, Action: "update", Snapshot: &after}, &before)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Exercise updated"})
 }
 
+// Patch applies a JSON Merge Patch or JSON Patch document to an exercise
+// and only writes the fields that changed.
+func (h *ExerciseHandler) Patch(c *gin.Context) {
+	id := c.Param("id")
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("exercises")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var original models.Exercise
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&original)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if status, message := checkExerciseWrite(c, h.Enforcer, &original); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	var exercise models.Exercise
+	if err := patchDocument(c, original, &exercise); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exercise.ID = original.ID
+	exercise.OwnerID = original.OwnerID
+	// Legacy muscle strings in the patch replace the stored muscle IDs
+	if exercise.PrimaryMuscles != "" {
+		exercise.PrimaryMuscleIDs = nil
+	}
+	if exercise.SecondaryMuscles != "" {
+		exercise.SecondaryMuscleIDs = nil
+	}
+	if err := validateExercise(&exercise); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exercise.Media = original.Media
+	exercise.Archived, exercise.ArchivedAt = original.Archived, original.ArchivedAt
+
+	update, err := changedFields(original, exercise)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(update) > 0 {
+		result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+			return
+		}
+		recordRevision(ctx, c, h.DB, models.ExerciseRevision{ExerciseID: objectID, Action: "update", Snapshot: &exercise}, &original)
+	}
+
+	c.JSON(http.StatusOK, exercise)
+}
+
 func (h *ExerciseHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -144,20 +373,236 @@ func (h *ExerciseHandler) Delete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	// policy decides what happens to exercises used by routines: "reject"
+	// refuses to delete them, "archive" hides them from the catalog instead.
+	policy := c.DefaultQuery("policy", "reject")
+	if policy != "reject" && policy != "archive" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "policy must be reject or archive"})
+		return
+	}
 	collection := h.DB.Database("gym-app").Collection("exercises")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	var existing models.Exercise
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&existing)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if status, message := checkExerciseWrite(c, h.Enforcer, &existing); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	if policy == "archive" {
+		now := time.Now()
+		update := bson.M{"$set": bson.M{"archived": true, "archived_at": now}}
+		var before models.Exercise
+		err := collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update).Decode(&before)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		after := before
+		after.Archived = true
+		after.ArchivedAt = &now
+		recordRevision(ctx, c, h.DB, models.ExerciseRevision{ExerciseID: objectID, Action: "archive", Snapshot: &after}, &before)
+		c.JSON(http.StatusOK, gin.H{"message": "Exercise archived"})
+		return
+	}
+
+	routines, err := referencingRoutines(ctx, h.DB, objectID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+	if len(routines) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Exercise is used by routines", "routines": routines})
+		return
+	}
+
+	var deleted models.Exercise
+	err = collection.FindOneAndDelete(ctx, bson.M{"_id": objectID}).Decode(&deleted)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
+	recordRevision(ctx, c, h.DB, models.ExerciseRevision{ExerciseID: objectID, Action: "delete"}, &deleted)
+	for _, media := range deleted.Media {
+		h.deleteMediaFiles(ctx, media)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Exercise deleted"})
 }
+
+// prepareExercise normalizes a bound exercise before it is stored.
+func prepareExercise(exercise *models.Exercise) error {
+	// A localized response sent back as is would overwrite the default
+	// locale text with the translation.
+	if exercise.Locale != "" && exercise.Locale != models.DefaultLocale {
+		return errors.New("localized exercises cannot be written back, update the translation instead")
+	}
+	exercise.Locale = ""
+	exercise.MuscleNames = nil
+	exercise.Media = nil
+	// Exercises are only archived by deleting them with the archive policy
+	exercise.Archived = false
+	exercise.ArchivedAt = nil
+
+	if err := resolveMuscles(exercise); err != nil {
+		return err
+	}
+	if err := resolveTranslations(exercise); err != nil {
+		return err
+	}
+	if err := resolveExerciseContent(exercise); err != nil {
+		return err
+	}
+	return resolveExerciseEquipment(exercise)
+}
+
+// Limits on the coaching text of an exercise.
+const (
+	maxContentItems  = 20
+	maxContentLength = 500
+)
+
+// resolveExerciseContent trims the coaching text of an exercise and checks
+// its enum fields, which are stored lower case.
+func resolveExerciseContent(exercise *models.Exercise) error {
+	lists := []struct {
+		name  string
+		items *[]string
+	}{
+		{"instructions", &exercise.Instructions},
+		{"cues", &exercise.Cues},
+		{"mistakes", &exercise.Mistakes},
+	}
+	for _, list := range lists {
+		items, err := cleanContentList(list.name, *list.items)
+		if err != nil {
+			return err
+		}
+		*list.items = items
+	}
+
+	enums := []struct {
+		name    string
+		value   *string
+		allowed []string
+	}{
+		{"difficulty", &exercise.Difficulty, models.Difficulties},
+		{"movement_pattern", &exercise.MovementPattern, models.MovementPatterns},
+		{"laterality", &exercise.Laterality, models.Lateralities},
+		{"force_type", &exercise.ForceType, models.ForceTypes},
+	}
+	for _, enum := range enums {
+		if *enum.value == "" {
+			continue
+		}
+		value, err := enumValue(enum.name, *enum.value, enum.allowed)
+		if err != nil {
+			return err
+		}
+		*enum.value = value
+	}
+	return nil
+}
+
+// cleanContentList trims the items of a text list and drops empty ones.
+func cleanContentList(name string, items []string) ([]string, error) {
+	var cleaned []string
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if len(item) > maxContentLength {
+			return nil, fmt.Errorf("%s items must be at most %d characters", name, maxContentLength)
+		}
+		cleaned = append(cleaned, item)
+	}
+	if len(cleaned) > maxContentItems {
+		return nil, fmt.Errorf("%s can have at most %d items", name, maxContentItems)
+	}
+	return cleaned, nil
+}
+
+// enumValue matches value case insensitively against the allowed values of
+// the name field.
+func enumValue(name, value string, allowed []string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, candidate := range allowed {
+		if candidate == value {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%s must be one of %s", name, strings.Join(allowed, ", "))
+}
+
+// resolveMuscles converts legacy muscle strings into muscle IDs when the
+// client did not send IDs, and checks every ID against the registry.
+func resolveMuscles(exercise *models.Exercise) error {
+	if len(exercise.PrimaryMuscleIDs) == 0 && exercise.PrimaryMuscles != "" {
+		ids, unknown := models.ParseMuscleList(exercise.PrimaryMuscles)
+		if len(unknown) > 0 {
+			return fmt.Errorf("unknown muscles: %s", strings.Join(unknown, ", "))
+		}
+		exercise.PrimaryMuscleIDs = ids
+	}
+	if len(exercise.SecondaryMuscleIDs) == 0 && exercise.SecondaryMuscles != "" {
+		ids, unknown := models.ParseMuscleList(exercise.SecondaryMuscles)
+		if len(unknown) > 0 {
+			return fmt.Errorf("unknown muscles: %s", strings.Join(unknown, ", "))
+		}
+		exercise.SecondaryMuscleIDs = ids
+	}
+	exercise.PrimaryMuscles = ""
+	exercise.SecondaryMuscles = ""
+
+	if len(exercise.PrimaryMuscleIDs) == 0 {
+		return errors.New("at least one primary muscle is required")
+	}
+	if exercise.SecondaryMuscleIDs == nil {
+		exercise.SecondaryMuscleIDs = []string{}
+	}
+	for _, ids := range [][]string{exercise.PrimaryMuscleIDs, exercise.SecondaryMuscleIDs} {
+		for i, id := range ids {
+			muscle, ok := models.LookupMuscle(id)
+			if !ok {
+				return fmt.Errorf("unknown muscle: %s", id)
+			}
+			ids[i] = muscle.ID
+		}
+	}
+	return nil
+}
+
+// resolveExerciseEquipment canonicalizes the equipment of an exercise, or
+// infers it from the name when the client sent none.
+func resolveExerciseEquipment(exercise *models.Exercise) error {
+	if len(exercise.Equipment) == 0 {
+		exercise.Equipment = models.InferEquipment(exercise.Exercise)
+		return nil
+	}
+	equipment, err := resolveEquipment(exercise.Equipment)
+	if err != nil {
+		return err
+	}
+	exercise.Equipment = equipment
+	return nil
+}
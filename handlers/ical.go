@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// icalDays are the iCalendar names of the ISO weekdays 1 to 7.
+var icalDays = [...]string{"", "MO", "TU", "WE", "TH", "FR", "SA", "SU"}
+
+// defaultSessionMinutes is the length of a calendar event for routines
+// without an estimated duration.
+const defaultSessionMinutes = 60
+
+// timezoneYears is how many years ahead the timezone rules of open-ended
+// entries are written. Calendar apps refetch the feed, so the rules move
+// forward with it.
+const timezoneYears = 5
+
+// calendarWriter builds an iCalendar (RFC 5545) document.
+type calendarWriter struct {
+	b strings.Builder
+}
+
+// line writes a content line, folded at 75 octets as the format requires.
+func (w *calendarWriter) line(name, value string) {
+	line := name + ":" + value
+	// Continuation lines start with a space, which counts towards the limit
+	for limit := 75; len(line) > limit; limit = 74 {
+		cut := limit
+		// Do not split a UTF-8 sequence
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	w.b.WriteString(line + "\r\n")
+}
+
+// icalText escapes a TEXT value.
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icalOffset formats a UTC offset in seconds as a UTC-OFFSET value.
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	offset := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		offset += fmt.Sprintf("%02d", seconds%60)
+	}
+	return offset
+}
+
+// zoneTransitions returns the instants from from to to at which the UTC
+// offset of location changes.
+func zoneTransitions(location *time.Location, from, to time.Time) []time.Time {
+	var transitions []time.Time
+	_, offset := from.In(location).Zone()
+	for day := from.Unix(); day < to.Unix(); day += 24 * 60 * 60 {
+		next := day + 24*60*60
+		if _, changed := time.Unix(next, 0).In(location).Zone(); changed == offset {
+			continue
+		}
+		// The first second with the new offset
+		before, after := day, next
+		for after-before > 1 {
+			middle := (before + after) / 2
+			if _, current := time.Unix(middle, 0).In(location).Zone(); current == offset {
+				before = middle
+			} else {
+				after = middle
+			}
+		}
+		transition := time.Unix(after, 0)
+		transitions = append(transitions, transition)
+		_, offset = transition.In(location).Zone()
+	}
+	return transitions
+}
+
+// timezone writes a VTIMEZONE component with the offsets of location from
+// from to to, one observance per offset change. Clients need it to place
+// the DTSTART;TZID times of the feed.
+func (w *calendarWriter) timezone(location *time.Location, from, to time.Time) {
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", location.String())
+	_, offset := from.In(location).Zone()
+	w.observance(location, from, offset)
+	for _, transition := range zoneTransitions(location, from, to) {
+		w.observance(location, transition, offset)
+		_, offset = transition.In(location).Zone()
+	}
+	w.line("END", "VTIMEZONE")
+}
+
+// observance writes the STANDARD or DAYLIGHT observance of location that
+// starts at start, when the offset changes from offsetFrom.
+func (w *calendarWriter) observance(location *time.Location, start time.Time, offsetFrom int) {
+	local := start.In(location)
+	name, offset := local.Zone()
+	kind := "STANDARD"
+	if local.IsDST() {
+		kind = "DAYLIGHT"
+	}
+	w.line("BEGIN", kind)
+	// The onset is written in the local time before the change
+	w.line("DTSTART", start.UTC().Add(time.Duration(offsetFrom)*time.Second).Format("20060102T150405"))
+	w.line("TZOFFSETFROM", icalOffset(offsetFrom))
+	w.line("TZOFFSETTO", icalOffset(offset))
+	w.line("TZNAME", icalText(name))
+	w.line("END", kind)
+}
+
+// timezoneSpan is the years the events of a timezone fall in.
+type timezoneSpan struct {
+	location *time.Location
+	from, to int
+}
+
+// writeCalendar renders the schedule entries of a user as an iCalendar
+// feed. Weekly entries become recurring events. Entries whose routine no
+// longer exists or that never occur are left out. Entries with a time in a
+// timezone other than UTC get a VTIMEZONE for their zone covering their
+// dates, or up to timezoneYears after now when they have no end.
+func writeCalendar(entries []models.ScheduleEntry, routines map[primitive.ObjectID]models.Routine, now time.Time) string {
+	w := &calendarWriter{}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//gym-api//schedule//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("X-WR-CALNAME", "Workouts")
+
+	type event struct {
+		entry    models.ScheduleEntry
+		routine  models.Routine
+		first    time.Time
+		location *time.Location
+	}
+	var events []event
+	var zones []string
+	spans := make(map[string]*timezoneSpan)
+	for _, entry := range entries {
+		routine, ok := routines[entry.RoutineID]
+		if !ok {
+			continue
+		}
+		first, ok := firstOccurrence(entry)
+		if !ok {
+			continue
+		}
+		e := event{entry: entry, routine: routine, first: first}
+		if entry.Time != "" && entry.Timezone != "UTC" {
+			if location, err := time.LoadLocation(entry.Timezone); err == nil {
+				e.location = location
+				last := now.Year() + timezoneYears
+				if entry.Date != "" {
+					last = first.Year()
+				} else if end, err := time.Parse(dateLayout, entry.EndDate); err == nil {
+					last = end.Year()
+				}
+				span, ok := spans[entry.Timezone]
+				if !ok {
+					span = &timezoneSpan{location: location, from: first.Year(), to: last}
+					spans[entry.Timezone] = span
+					zones = append(zones, entry.Timezone)
+				}
+				span.from, span.to = min(span.from, first.Year()), max(span.to, last)
+			}
+		}
+		events = append(events, e)
+	}
+	for _, zone := range zones {
+		span := spans[zone]
+		w.timezone(span.location, time.Date(span.from, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(span.to+1, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+
+	for _, e := range events {
+		entry, routine, first := e.entry, e.routine, e.first
+
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", entry.ID.Hex()+"@gym-api")
+		w.line("DTSTAMP", entry.UpdatedAt.UTC().Format("20060102T150405Z"))
+		w.line("SUMMARY", icalText(routine.Name))
+		if routine.Description != "" {
+			w.line("DESCRIPTION", icalText(routine.Description))
+		}
+
+		var until string
+		if entry.Time == "" {
+			w.line("DTSTART;VALUE=DATE", first.Format("20060102"))
+			w.line("DTEND;VALUE=DATE", first.AddDate(0, 0, 1).Format("20060102"))
+			if end, err := time.Parse(dateLayout, entry.EndDate); err == nil {
+				until = end.Format("20060102")
+			}
+		} else {
+			start := startTime(entry, first)
+			if e.location == nil {
+				w.line("DTSTART", start.UTC().Format("20060102T150405Z"))
+			} else {
+				w.line("DTSTART;TZID="+entry.Timezone, start.Format("20060102T150405"))
+			}
+			minutes := routine.EstimatedMinutes
+			if minutes == 0 {
+				minutes = defaultSessionMinutes
+			}
+			w.line("DURATION", fmt.Sprintf("PT%dM", minutes))
+			// UNTIL is in UTC for events with a time, and includes a
+			// session on the end date
+			if end, err := time.Parse(dateLayout, entry.EndDate); err == nil {
+				until = startTime(entry, end).UTC().Format("20060102T150405Z")
+			}
+		}
+
+		if len(entry.Weekdays) > 0 {
+			days := make([]string, len(entry.Weekdays))
+			for i, day := range entry.Weekdays {
+				days[i] = icalDays[day]
+			}
+			rule := "FREQ=WEEKLY;BYDAY=" + strings.Join(days, ",")
+			if until != "" {
+				rule += ";UNTIL=" + until
+			}
+			w.line("RRULE", rule)
+		}
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+	return w.b.String()
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestLocale picks the locale of the response from the lang query
+// parameter or, failing that, the Accept-Language header. Unsupported
+// languages in the header fall back to the default locale; an unsupported
+// lang parameter is an error.
+func requestLocale(c *gin.Context) (string, error) {
+	c.Header("Vary", "Accept-Language")
+	locale := models.DefaultLocale
+	if lang := c.Query("lang"); lang != "" {
+		matched, ok := models.LookupLocale(lang)
+		if !ok {
+			return "", errors.New("Unsupported language: " + lang + ", supported languages are: " + strings.Join(models.Locales, ", "))
+		}
+		locale = matched
+	} else if header := c.GetHeader("Accept-Language"); header != "" {
+		locale = negotiateLocale(header)
+	}
+	c.Header("Content-Language", locale)
+	return locale, nil
+}
+
+// negotiateLocale returns the supported locale with the highest quality in
+// an Accept-Language header such as "es-MX,es;q=0.9,en;q=0.5".
+func negotiateLocale(header string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		if tag != "" && quality > 0 {
+			languages = append(languages, language{tag: tag, quality: quality})
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].quality > languages[j].quality })
+
+	for _, language := range languages {
+		if language.tag == "*" {
+			break
+		}
+		if locale, ok := models.LookupLocale(language.tag); ok {
+			return locale
+		}
+	}
+	return models.DefaultLocale
+}
+
+// localizeExercise replaces the text of an exercise with its translation
+// for locale, keeping the default locale text for anything untranslated,
+// and drops the other translations from the response.
+func localizeExercise(exercise *models.Exercise, locale string) {
+	translation := exercise.Translations[locale]
+	if locale != models.DefaultLocale {
+		if translation.Name != "" {
+			exercise.Exercise = translation.Name
+		}
+		if len(translation.Instructions) > 0 {
+			exercise.Instructions = translation.Instructions
+		}
+		if len(translation.Cues) > 0 {
+			exercise.Cues = translation.Cues
+		}
+		if len(translation.Mistakes) > 0 {
+			exercise.Mistakes = translation.Mistakes
+		}
+	}
+
+	exercise.MuscleNames = make(map[string]string)
+	for _, ids := range [][]string{exercise.PrimaryMuscleIDs, exercise.SecondaryMuscleIDs} {
+		for _, id := range ids {
+			if name := translation.Muscles[id]; name != "" && locale != models.DefaultLocale {
+				exercise.MuscleNames[id] = name
+			} else if muscle, ok := models.LookupMuscle(id); ok {
+				exercise.MuscleNames[id] = muscle.Name
+			}
+		}
+	}
+	exercise.Locale = locale
+	exercise.Translations = nil
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MuscleHandler struct{}
+
+func (h *MuscleHandler) GetAll(c *gin.Context) {
+	region := strings.ToLower(c.Query("region"))
+	if region == "" {
+		c.JSON(http.StatusOK, models.Muscles)
+		return
+	}
+
+	muscles := []models.Muscle{}
+	for _, muscle := range models.Muscles {
+		if muscle.Region == region {
+			muscles = append(muscles, muscle)
+		}
+	}
+	c.JSON(http.StatusOK, muscles)
+}
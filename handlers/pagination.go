@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 500
+)
+
+// listQuery holds the pagination, sorting and projection options of a list
+// request. Query parameters use JSON field names; they are translated to
+// the bson names of the model before reaching Mongo.
+type listQuery struct {
+	limit     int64
+	sortParam string
+	sortField string
+	desc      bool
+	fields    []string
+	after     *pageCursor
+	bsonNames map[string]string
+	// loaded lists bson fields read from Mongo even when they are not
+	// among the requested fields.
+	loaded []string
+}
+
+// pageCursor is the position after the last document of a page. It is sent
+// to clients base64 encoded in the X-Next-Cursor header.
+type pageCursor struct {
+	Sort  string             `bson:"s"`
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// parseListQuery reads limit, sort, fields and cursor from the query string.
+// model is a value of the listed type and sortable lists the JSON field
+// names clients may sort on.
+func parseListQuery(c *gin.Context, model interface{}, sortable ...string) (*listQuery, error) {
+	q := &listQuery{limit: defaultPageLimit, sortField: "_id", bsonNames: bsonFieldNames(model)}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		q.limit = n
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		name := strings.TrimPrefix(sort, "-")
+		allowed := false
+		for _, field := range sortable {
+			if strings.EqualFold(field, name) {
+				name = field
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("cannot sort by %q, allowed fields are: %s", name, strings.Join(sortable, ", "))
+		}
+		q.sortParam = sort
+		q.sortField = q.bsonNames[name]
+		q.desc = strings.HasPrefix(sort, "-")
+	}
+
+	if fields := c.Query("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			if _, ok := q.bsonNames[field]; !ok {
+				return nil, fmt.Errorf("unknown field %q", field)
+			}
+			q.fields = append(q.fields, field)
+		}
+	}
+
+	if encoded := c.Query("cursor"); encoded != "" {
+		data, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		var cursor pageCursor
+		if err := bson.Unmarshal(data, &cursor); err != nil || cursor.Sort != q.sortParam {
+			return nil, errors.New("invalid cursor")
+		}
+		q.after = &cursor
+	}
+
+	return q, nil
+}
+
+// findPage runs filter against collection and decodes one page of documents
+// into results, which must be a pointer to a slice. It sets the
+// X-Total-Count header to the number of documents matching filter and, when
+// more documents follow, X-Next-Cursor to the cursor of the next page.
+func findPage(ctx context.Context, c *gin.Context, collection *mongo.Collection, filter bson.M, q *listQuery, results interface{}) error {
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	direction := 1
+	if q.desc {
+		direction = -1
+	}
+	sort := bson.D{{Key: "_id", Value: direction}}
+	if q.sortField != "_id" {
+		sort = append(bson.D{{Key: q.sortField, Value: direction}}, sort...)
+	}
+	opts := options.Find().SetSort(sort).SetLimit(q.limit + 1)
+	if len(q.fields) > 0 {
+		projection := bson.M{q.sortField: 1}
+		for _, field := range q.fields {
+			projection[q.bsonNames[field]] = 1
+		}
+		for _, field := range q.loaded {
+			projection[field] = 1
+		}
+		opts.SetProjection(projection)
+	}
+
+	pageFilter := filter
+	if q.after != nil {
+		pageFilter = bson.M{"$and": []bson.M{filter, q.afterFilter()}}
+	}
+
+	cursor, err := collection.Find(ctx, pageFilter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.Raw
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+
+	if int64(len(docs)) > q.limit {
+		docs = docs[:q.limit]
+		next, err := q.nextCursor(docs[len(docs)-1])
+		if err != nil {
+			return err
+		}
+		c.Header("X-Next-Cursor", next)
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+
+	slice := reflect.ValueOf(results).Elem()
+	page := reflect.MakeSlice(slice.Type(), 0, len(docs))
+	for _, doc := range docs {
+		item := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(doc, item.Interface()); err != nil {
+			return err
+		}
+		page = reflect.Append(page, item.Elem())
+	}
+	slice.Set(page)
+	return nil
+}
+
+// afterFilter matches the documents that sort after the cursor position.
+// Documents without the sort field sort before all others; comparisons with
+// null only match null, so they are matched explicitly.
+func (q *listQuery) afterFilter() bson.M {
+	op := "$gt"
+	if q.desc {
+		op = "$lt"
+	}
+	if q.sortField == "_id" {
+		return bson.M{"_id": bson.M{op: q.after.ID}}
+	}
+	if q.after.Value == nil {
+		after := []bson.M{{q.sortField: nil, "_id": bson.M{op: q.after.ID}}}
+		if !q.desc {
+			after = append(after, bson.M{q.sortField: bson.M{"$ne": nil}})
+		}
+		return bson.M{"$or": after}
+	}
+	after := []bson.M{
+		{q.sortField: bson.M{op: q.after.Value}},
+		{q.sortField: q.after.Value, "_id": bson.M{op: q.after.ID}},
+	}
+	if q.desc {
+		after = append(after, bson.M{q.sortField: nil})
+	}
+	return bson.M{"$or": after}
+}
+
+func (q *listQuery) nextCursor(last bson.Raw) (string, error) {
+	cursor := pageCursor{Sort: q.sortParam}
+	if id, ok := last.Lookup("_id").ObjectIDOK(); ok {
+		cursor.ID = id
+	}
+	if q.sortField != "_id" {
+		if value, err := last.LookupErr(q.sortField); err == nil {
+			if err := value.Unmarshal(&cursor.Value); err != nil {
+				return "", err
+			}
+		}
+	}
+	data, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// load adds bson fields that the handler needs to build its response to the
+// projection of a fields request.
+func (q *listQuery) load(fields ...string) {
+	q.loaded = append(q.loaded, fields...)
+}
+
+// project trims each item of results down to the requested fields. Without
+// a fields parameter results is returned unchanged.
+func (q *listQuery) project(results interface{}) (interface{}, error) {
+	if len(q.fields) == 0 {
+		return results, nil
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	projected := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		trimmed := map[string]interface{}{"id": item["id"]}
+		for _, field := range q.fields {
+			if value, ok := item[field]; ok {
+				trimmed[field] = value
+			}
+		}
+		projected = append(projected, trimmed)
+	}
+	return projected, nil
+}
+
+// bsonFieldNames maps the JSON name of every stored field of a model struct
+// to its bson name.
+func bsonFieldNames(model interface{}) map[string]string {
+	names := make(map[string]string)
+	t := reflect.TypeOf(model)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		bsonName := strings.Split(field.Tag.Get("bson"), ",")[0]
+		if jsonName == "" || jsonName == "-" || bsonName == "" || bsonName == "-" {
+			continue
+		}
+		names[jsonName] = bsonName
+	}
+	return names
+}
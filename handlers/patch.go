@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// patchDocument applies the request body to original and decodes the result
+// into patched, which must be a pointer to a new value of the same type.
+// Bodies sent as application/json-patch+json are JSON Patch (RFC 6902)
+// documents; anything else is treated as a JSON Merge Patch (RFC 7396).
+func patchDocument(c *gin.Context, original interface{}, patched interface{}) error {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return errors.New("Request body is empty")
+	}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType == jsonPatchContentType {
+		var operations []jsonPatchOperation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			return fmt.Errorf("invalid JSON Patch document: %w", err)
+		}
+		if doc, err = applyJSONPatch(doc, operations); err != nil {
+			return err
+		}
+	} else {
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return fmt.Errorf("invalid merge patch document: %w", err)
+		}
+		doc = mergePatch(doc, patch)
+	}
+
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(patched); err != nil {
+		return fmt.Errorf("patched document is invalid: %w", err)
+	}
+	return nil
+}
+
+// mergePatch applies an RFC 7396 merge patch: objects are merged
+// recursively, null removes a member and any other value replaces it.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// applyJSONPatch applies RFC 6902 operations in order. The whole patch fails
+// if any operation fails.
+func applyJSONPatch(doc interface{}, operations []jsonPatchOperation) (interface{}, error) {
+	var err error
+	for i, operation := range operations {
+		var value interface{}
+		if operation.Value != nil {
+			if err := json.Unmarshal(*operation.Value, &value); err != nil {
+				return nil, err
+			}
+		}
+
+		switch operation.Op {
+		case "add":
+			if operation.Value == nil {
+				return nil, fmt.Errorf("operation %d: value is required", i)
+			}
+			doc, err = pointerAdd(doc, operation.Path, value)
+		case "remove":
+			doc, _, err = pointerRemove(doc, operation.Path)
+		case "replace":
+			if operation.Value == nil {
+				return nil, fmt.Errorf("operation %d: value is required", i)
+			}
+			if doc, _, err = pointerRemove(doc, operation.Path); err == nil {
+				doc, err = pointerAdd(doc, operation.Path, value)
+			}
+		case "move":
+			var moved interface{}
+			if doc, moved, err = pointerRemove(doc, operation.From); err == nil {
+				doc, err = pointerAdd(doc, operation.Path, moved)
+			}
+		case "copy":
+			var copied interface{}
+			if copied, err = pointerGet(doc, operation.From); err == nil {
+				doc, err = pointerAdd(doc, operation.Path, deepCopy(copied))
+			}
+		case "test":
+			var current interface{}
+			if current, err = pointerGet(doc, operation.Path); err == nil && !reflect.DeepEqual(current, value) {
+				err = fmt.Errorf("test failed at %s", operation.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", operation.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || (!allowEnd && index == length) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
+
+func pointerGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+	}
+	return current, nil
+}
+
+// pointerAdd returns doc with value added at pointer. Arrays are grown by
+// inserting at the index, objects get the member set or replaced.
+func pointerAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, pointer[:strings.LastIndex(pointer, "/")])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node[:index], append([]interface{}{value}, node[index:]...)...)
+		return replaceParent(doc, pointer, node)
+	default:
+		return nil, fmt.Errorf("path %s does not exist", pointer)
+	}
+	return doc, nil
+}
+
+// pointerRemove returns doc without the value at pointer, and that value.
+func pointerRemove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := pointerGet(doc, pointer[:strings.LastIndex(pointer, "/")])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+		delete(node, last)
+		return doc, value, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+		doc, err = replaceParent(doc, pointer, node)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("path %s does not exist", pointer)
+	}
+}
+
+// replaceParent stores a resized array back into its parent, since growing
+// or shrinking a slice does not update the parent's reference to it.
+func replaceParent(doc interface{}, pointer string, array []interface{}) (interface{}, error) {
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	if parentPointer == "" {
+		return array, nil
+	}
+	grandparent, err := pointerGet(doc, parentPointer[:strings.LastIndex(parentPointer, "/")])
+	if err != nil {
+		return nil, err
+	}
+	tokens, _ := parsePointer(parentPointer)
+	last := tokens[len(tokens)-1]
+	switch node := grandparent.(type) {
+	case map[string]interface{}:
+		node[last] = array
+	case []interface{}:
+		index, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = array
+	}
+	return doc, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	data, _ := json.Marshal(value)
+	var copied interface{}
+	json.Unmarshal(data, &copied)
+	return copied
+}
+
+// changedFields compares two versions of a model and returns a Mongo update
+// that only sets the top level fields that changed and unsets the ones that
+// were removed.
+func changedFields(original, patched interface{}) (bson.M, error) {
+	before, err := bson.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+	after, err := bson.Marshal(patched)
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	elements, err := bson.Raw(after).Elements()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range elements {
+		previous, err := bson.Raw(before).LookupErr(element.Key())
+		if err != nil || !rawValuesEqual(previous, element.Value()) {
+			set[element.Key()] = element.Value()
+		}
+	}
+	elements, err = bson.Raw(before).Elements()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range elements {
+		if _, err := bson.Raw(after).LookupErr(element.Key()); err != nil {
+			unset[element.Key()] = ""
+		}
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
+}
+
+// rawValuesEqual compares two bson values, ignoring the order of the keys
+// of embedded documents since documents marshaled from Go maps have no
+// stable key order.
+func rawValuesEqual(a, b bson.RawValue) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+		// Arrays are encoded as documents keyed by index
+		left, err := bson.Raw(a.Value).Elements()
+		if err != nil {
+			return false
+		}
+		right, err := bson.Raw(b.Value).Elements()
+		if err != nil || len(left) != len(right) {
+			return false
+		}
+		for _, element := range left {
+			other, err := bson.Raw(b.Value).LookupErr(element.Key())
+			if err != nil || !rawValuesEqual(element.Value(), other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return bytes.Equal(a.Value, b.Value)
+	}
+}
+
+// replacementFields returns doc as a $set document for a full replacement,
+// leaving out fields that are never replaced such as the creation time.
+func replacementFields(doc interface{}, keep ...string) (bson.M, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "_id")
+	for _, field := range keep {
+		delete(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ProfileHandler struct {
+	DB *mongo.Client
+}
+
+func (h *ProfileHandler) GetEquipment(c *gin.Context) {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	equipment, err := availableEquipment(ctx, h.DB, userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"available_equipment": equipment})
+}
+
+func (h *ProfileHandler) UpdateEquipment(c *gin.Context) {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var profile struct {
+		AvailableEquipment []string `json:"available_equipment" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	equipment, err := resolveEquipment(profile.AvailableEquipment)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"available_equipment": equipment}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"available_equipment": equipment})
+}
+
+// availableEquipment returns the equipment profile of a user. Users who
+// never set one get an empty list.
+func availableEquipment(ctx context.Context, client *mongo.Client, userID primitive.ObjectID) ([]string, error) {
+	collection := client.Database("gym-app").Collection("users")
+	opts := options.FindOne().SetProjection(bson.M{"available_equipment": 1})
+
+	var user models.User
+	if err := collection.FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&user); err != nil {
+		return nil, err
+	}
+	if user.AvailableEquipment == nil {
+		return []string{}, nil
+	}
+	return user.AvailableEquipment, nil
+}
+
+// maxPlateIncrement caps the plate increment a user can set, in their unit.
+const maxPlateIncrement = 50.0
+
+func (h *ProfileHandler) GetUnits(c *gin.Context) {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"weight_unit": 1, "plate_increment": 1})
+	if err := collection.FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if user.WeightUnit == "" {
+		user.WeightUnit = models.UnitKg
+	}
+	if user.PlateIncrement == 0 {
+		user.PlateIncrement = models.DefaultPlateIncrements[user.WeightUnit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"weight_unit": user.WeightUnit, "plate_increment": user.PlateIncrement})
+}
+
+// UpdateUnits sets the preferred weight unit of the user and optionally
+// the smallest weight step they can load. Without plate_increment the
+// default for the unit is used.
+func (h *ProfileHandler) UpdateUnits(c *gin.Context) {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var profile struct {
+		WeightUnit     string  `json:"weight_unit" binding:"required"`
+		PlateIncrement float64 `json:"plate_increment"`
+	}
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	unit, err := enumValue("weight_unit", profile.WeightUnit, models.WeightUnits)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if profile.PlateIncrement < 0 || profile.PlateIncrement > maxPlateIncrement {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("plate_increment must be between 0 and %g", maxPlateIncrement)})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{"weight_unit": unit}
+	update := bson.M{"$set": set}
+	if profile.PlateIncrement > 0 {
+		set["plate_increment"] = profile.PlateIncrement
+	} else {
+		update["$unset"] = bson.M{"plate_increment": ""}
+		profile.PlateIncrement = models.DefaultPlateIncrements[unit]
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"weight_unit": unit, "plate_increment": profile.PlateIncrement})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Limits on the structure of a program.
+const (
+	maxProgramWeeks        = 52
+	maxProgramDays         = 100
+	maxProgramProgressions = 100
+	maxDeloadPercent       = 90.0
+	daysPerWeek            = 7
+)
+
+// checkProgram validates a program and writes an error response listing
+// every invalid field when it fails. Increments without a unit are in unit.
+func checkProgram(c *gin.Context, program *models.Program, unit string) bool {
+	errs := validateProgram(program, unit)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Program is invalid", "fields": errs})
+		return false
+	}
+	return true
+}
+
+// validateProgram checks the ranges of a program, that no day is scheduled
+// twice and that every exercise has at most one progression.
+func validateProgram(program *models.Program, unit string) []fieldError {
+	var errs []fieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, fieldError{Field: field, Error: fmt.Sprintf(format, args...)})
+	}
+
+	program.Name = strings.TrimSpace(program.Name)
+	if program.Name == "" {
+		add("name", "is required")
+	} else if len(program.Name) > maxRoutineNameLength {
+		add("name", "must be at most %d characters", maxRoutineNameLength)
+	}
+	if len(program.Description) > maxRoutineDescriptionLength {
+		add("description", "must be at most %d characters", maxRoutineDescriptionLength)
+	}
+	if program.Weeks < 1 || program.Weeks > maxProgramWeeks {
+		add("weeks", "must be between 1 and %d", maxProgramWeeks)
+	}
+
+	if len(program.Days) > maxProgramDays {
+		add("days", "must have at most %d days", maxProgramDays)
+	}
+	scheduled := make(map[[2]int]int)
+	for i, day := range program.Days {
+		path := fmt.Sprintf("days[%d]", i)
+		if day.Week < 0 || day.Week > program.Weeks {
+			add(path+".week", "must be between 0 and %d", program.Weeks)
+		}
+		if day.Day < 1 || day.Day > daysPerWeek {
+			add(path+".day", "must be between 1 and %d", daysPerWeek)
+		}
+		if day.RoutineID.IsZero() {
+			add(path+".routine_id", "is required")
+		}
+		key := [2]int{day.Week, day.Day}
+		if first, ok := scheduled[key]; ok {
+			add(path, "schedules the same day as days[%d]", first)
+		} else {
+			scheduled[key] = i
+		}
+	}
+
+	if len(program.Progressions) > maxProgramProgressions {
+		add("progressions", "must have at most %d progressions", maxProgramProgressions)
+	}
+	progressed := make(map[primitive.ObjectID]int)
+	for i, progression := range program.Progressions {
+		path := fmt.Sprintf("progressions[%d]", i)
+		if progression.ExerciseID.IsZero() {
+			add(path+".exercise_id", "is required")
+		} else if first, ok := progressed[progression.ExerciseID]; ok {
+			add(path+".exercise_id", "already has a progression in progressions[%d]", first)
+		} else {
+			progressed[progression.ExerciseID] = i
+		}
+		incrementUnit := unit
+		if progression.Unit != "" {
+			value, err := enumValue("unit", progression.Unit, models.WeightUnits)
+			if err != nil {
+				add(path+".unit", "must be one of %s", strings.Join(models.WeightUnits, ", "))
+			} else {
+				incrementUnit = value
+			}
+			program.Progressions[i].Unit = value
+		}
+		if limit := weightLimit(incrementUnit); progression.WeightIncrement < -limit || progression.WeightIncrement > limit {
+			add(path+".weight_increment", "must be between %g and %g %s", -limit, limit, incrementUnit)
+		}
+		if r := progression.RepRange; r != nil {
+			if r.Min < 1 || r.Min > maxReps {
+				add(path+".rep_range.min", "must be between 1 and %d", maxReps)
+			}
+			if r.Max < r.Min || r.Max > maxReps {
+				add(path+".rep_range.max", "must be between min and %d", maxReps)
+			}
+		}
+		if progression.DeloadEvery < 0 || progression.DeloadEvery == 1 {
+			add(path+".deload_every", "must be 0 or at least 2")
+		}
+		if progression.DeloadPercent < 0 || progression.DeloadPercent > maxDeloadPercent {
+			add(path+".deload_percent", "must be between 0 and %g", maxDeloadPercent)
+		} else if progression.DeloadEvery > 0 && progression.DeloadPercent == 0 {
+			add(path+".deload_percent", "is required with deload_every")
+		}
+	}
+	return errs
+}
+
+// missingRoutines returns the routine IDs scheduled by a program that do
+// not exist or belong to another user than owner.
+func missingRoutines(ctx context.Context, client *mongo.Client, owner primitive.ObjectID, days []models.ProgramDay) ([]primitive.ObjectID, error) {
+	missing := []primitive.ObjectID{}
+	if len(days) == 0 {
+		return missing, nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(days))
+	for _, day := range days {
+		ids = append(ids, day.RoutineID)
+	}
+
+	collection := client.Database("gym-app").Collection("routines")
+	existing, err := collection.Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": ids}, "user_id": owner})
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[primitive.ObjectID]bool)
+	for _, id := range existing {
+		if objectID, ok := id.(primitive.ObjectID); ok {
+			found[objectID] = true
+		}
+	}
+	for _, id := range ids {
+		if !found[id] {
+			found[id] = true
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+// checkProgramRoutines writes an error response and returns false when the
+// program schedules routines that do not exist.
+func checkProgramRoutines(ctx context.Context, c *gin.Context, client *mongo.Client, program models.Program) bool {
+	missing, err := missingRoutines(ctx, client, program.UserID, program.Days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Program references routines that do not exist", "missing_routine_ids": missing})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"math"
+
+	"gym-api/m/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// programWeek is one week of a program with the progressions applied to
+// the sets of its routines.
+type programWeek struct {
+	ProgramID primitive.ObjectID `json:"program_id"`
+	Week      int                `json:"week"`
+	Days      []programWeekDay   `json:"days"`
+}
+
+// programWeekDay is a scheduled routine on a day of a program week. Missing
+// is set when the routine no longer exists.
+type programWeekDay struct {
+	Day       int                   `json:"day"`
+	RoutineID primitive.ObjectID    `json:"routine_id"`
+	Name      string                `json:"name,omitempty"`
+	Exercises []programWeekExercise `json:"exercises"`
+	Missing   bool                  `json:"missing,omitempty"`
+}
+
+// programWeekExercise is a routine exercise with its sets for the week.
+// Deload is set when the week is a deload week for the exercise.
+type programWeekExercise struct {
+	models.RoutineExercise
+	Deload bool `json:"deload,omitempty"`
+}
+
+// weekDays returns the days scheduled in a week of the program, ordered by
+// day. A day of the specific week replaces a day repeated every week.
+func weekDays(program models.Program, week int) []models.ProgramDay {
+	var days [daysPerWeek + 1]*models.ProgramDay
+	for i := range program.Days {
+		day := &program.Days[i]
+		if day.Day < 1 || day.Day > daysPerWeek {
+			continue
+		}
+		if day.Week == week || (day.Week == 0 && days[day.Day] == nil) {
+			days[day.Day] = day
+		}
+	}
+	scheduled := []models.ProgramDay{}
+	for _, day := range days {
+		if day != nil {
+			scheduled = append(scheduled, *day)
+		}
+	}
+	return scheduled
+}
+
+// isDeloadWeek reports whether week is a deload week of the progression.
+func isDeloadWeek(progression models.Progression, week int) bool {
+	return progression.DeloadEvery > 0 && week%progression.DeloadEvery == 0
+}
+
+// progressSets returns the sets of an exercise for a week of the program.
+// Progress is counted in the weeks before week that are not deload weeks.
+func progressSets(progression models.Progression, sets []models.Set, week int) []models.Set {
+	steps := 0
+	for w := 1; w < week; w++ {
+		if !isDeloadWeek(progression, w) {
+			steps++
+		}
+	}
+
+	increments, reps := steps, 0
+	if r := progression.RepRange; r != nil {
+		span := r.Max - r.Min + 1
+		increments = steps / span
+		reps = r.Min + steps%span
+	}
+
+	weight := func(w float64) float64 {
+		w += float64(increments) * progression.WeightIncrement
+		if isDeloadWeek(progression, week) {
+			w *= 1 - progression.DeloadPercent/100
+		}
+		return math.Max(0, w)
+	}
+
+	progressed := make([]models.Set, len(sets))
+	for i, set := range sets {
+		// Rep ranges only apply to working sets, not to warm-ups or sets
+		// that are not counted in reps
+		if reps > 0 && (set.Type == "" || set.Type == models.SetNormal) {
+			set.Reps = reps
+		}
+		set.Weight = weight(set.Weight)
+		if len(set.Drops) > 0 {
+			set.Drops = append([]models.DropStep(nil), set.Drops...)
+			for j := range set.Drops {
+				set.Drops[j].Weight = weight(set.Drops[j].Weight)
+			}
+		}
+		progressed[i] = set
+	}
+	return progressed
+}
+
+// materializeWeek loads the routines scheduled in a week of the program
+// and applies the progressions to their sets. Weights are returned in
+// units, rounded to the plate increment where a progression changed them.
+func materializeWeek(ctx context.Context, client *mongo.Client, program models.Program, week int, units weightUnits) (programWeek, error) {
+	result := programWeek{ProgramID: program.ID, Week: week, Days: []programWeekDay{}}
+	days := weekDays(program, week)
+	if len(days) == 0 {
+		return result, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(days))
+	for i, day := range days {
+		ids[i] = day.RoutineID
+	}
+	collection := client.Database("gym-app").Collection("routines")
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": program.UserID})
+	if err != nil {
+		return result, err
+	}
+	defer cursor.Close(ctx)
+	var routines []models.Routine
+	if err := cursor.All(ctx, &routines); err != nil {
+		return result, err
+	}
+	byID := make(map[primitive.ObjectID]models.Routine, len(routines))
+	for _, routine := range routines {
+		byID[routine.ID] = routine
+	}
+
+	progressions := make(map[primitive.ObjectID]models.Progression, len(program.Progressions))
+	for _, progression := range program.Progressions {
+		progressions[progression.ExerciseID] = progression
+	}
+
+	for _, day := range days {
+		item := programWeekDay{Day: day.Day, RoutineID: day.RoutineID, Exercises: []programWeekExercise{}}
+		routine, ok := byID[day.RoutineID]
+		if !ok {
+			item.Missing = true
+			result.Days = append(result.Days, item)
+			continue
+		}
+		item.Name = routine.Name
+		for _, entry := range routine.Exercises {
+			exercise := programWeekExercise{RoutineExercise: entry}
+			progression, ok := progressions[entry.ExerciseID]
+			if ok {
+				exercise.Sets = progressSets(progression, entry.Sets, week)
+				exercise.Deload = isDeloadWeek(progression, week)
+			}
+			exercise.RoutineExercise = displayWeights([]models.RoutineExercise{exercise.RoutineExercise}, units, ok)[0]
+			item.Exercises = append(item.Exercises, exercise)
+		}
+		result.Days = append(result.Days, item)
+	}
+	return result, nil
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ProgramHandler struct {
+	DB       *mongo.Client
+	Enforcer *casbin.Enforcer
+}
+
+func (h *ProgramHandler) GetAll(c *gin.Context) {
+	query, err := parseListQuery(c, models.Program{}, "name", "created_at", "updated_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("programs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	var programs []models.Program
+	if err := findPage(ctx, c, collection, filter, query, &programs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range programs {
+		programs[i].Progressions = displayProgressions(programs[i].Progressions, &units)
+	}
+
+	response, err := query.project(programs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// findProgram loads the program named by the id path parameter if the
+// caller can see it. It writes an error response and returns false when it
+// cannot.
+func (h *ProgramHandler) findProgram(ctx context.Context, c *gin.Context) (bson.M, models.Program, bool) {
+	var program models.Program
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, program, false
+	}
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return nil, program, false
+	}
+	filter["_id"] = objectID
+
+	collection := h.DB.Database("gym-app").Collection("programs")
+	err = collection.FindOne(ctx, filter).Decode(&program)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Program not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, program, false
+	}
+	return filter, program, true
+}
+
+func (h *ProgramHandler) GetByID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, program, ok := h.findProgram(ctx, c)
+	if !ok {
+		return
+	}
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+	program.Progressions = displayProgressions(program.Progressions, &units)
+	c.JSON(http.StatusOK, program)
+}
+
+// GetWeek returns the routines of one week of a program with the
+// progression rules applied, i.e. the concrete sets and weights to train.
+func (h *ProgramHandler) GetWeek(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, program, ok := h.findProgram(ctx, c)
+	if !ok {
+		return
+	}
+	week, err := strconv.Atoi(c.Param("week"))
+	if err != nil || week < 1 || week > program.Weeks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("week must be between 1 and %d", program.Weeks)})
+		return
+	}
+
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	result, err := materializeWeek(ctx, h.DB, program, week, units)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *ProgramHandler) CreateProgram(c *gin.Context) {
+	var program models.Program
+	if err := c.ShouldBindJSON(&program); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("programs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Programs are owned by the user who creates them
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+	program.UserID = userID
+	if !checkProgram(c, &program, units.Unit) || !checkProgramRoutines(ctx, c, h.DB, program) {
+		return
+	}
+	normalizeProgressions(program.Progressions, units)
+	program.CreatedAt = time.Now()
+	program.UpdatedAt = program.CreatedAt
+	result, err := collection.InsertOne(ctx, program)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	program.ID = result.InsertedID.(primitive.ObjectID)
+	program.Progressions = displayProgressions(program.Progressions, &units)
+	c.JSON(http.StatusOK, program)
+}
+
+func (h *ProgramHandler) UpdateProgram(c *gin.Context) {
+	var program models.Program
+	if err := c.ShouldBindJSON(&program); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("programs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The program keeps its owner, also when an admin updates it
+	filter, existing, ok := h.findProgram(ctx, c)
+	if !ok {
+		return
+	}
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+	program.UserID = existing.UserID
+	if !checkProgram(c, &program, units.Unit) || !checkProgramRoutines(ctx, c, h.DB, program) {
+		return
+	}
+	normalizeProgressions(program.Progressions, units)
+	program.UpdatedAt = time.Now()
+	fields, err := replacementFields(program, "created_at")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Program not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Program updated"})
+}
+
+// PatchProgram applies a JSON Merge Patch or JSON Patch document to a
+// program and only writes the fields that changed. The owner and creation
+// time cannot be patched.
+func (h *ProgramHandler) PatchProgram(c *gin.Context) {
+	collection := h.DB.Database("gym-app").Collection("programs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, original, ok := h.findProgram(ctx, c)
+	if !ok {
+		return
+	}
+
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	// The patch applies to the increments as they were entered, not to the
+	// stored kilograms
+	entered := original
+	entered.Progressions = displayProgressions(original.Progressions, nil)
+	var program models.Program
+	if err := patchDocument(c, entered, &program); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	program.ID = original.ID
+	program.UserID = original.UserID
+	program.CreatedAt = original.CreatedAt
+	program.UpdatedAt = original.UpdatedAt
+	if err := binding.Validator.ValidateStruct(&program); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkProgram(c, &program, units.Unit) || !checkProgramRoutines(ctx, c, h.DB, program) {
+		return
+	}
+	normalizeProgressions(program.Progressions, units)
+
+	update, err := changedFields(original, program)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(update) > 0 {
+		program.UpdatedAt = time.Now()
+		set, _ := update["$set"].(bson.M)
+		if set == nil {
+			set = bson.M{}
+			update["$set"] = set
+		}
+		set["updated_at"] = program.UpdatedAt
+
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Program not found"})
+			return
+		}
+	}
+
+	program.Progressions = displayProgressions(program.Progressions, &units)
+	c.JSON(http.StatusOK, program)
+}
+
+func (h *ProgramHandler) DeleteProgram(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("programs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Program not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Program deleted"})
+}
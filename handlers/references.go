@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxListedReferences caps how many referencing routines are listed when an
+// exercise cannot be deleted.
+const maxListedReferences = 50
+
+type routineReference struct {
+	ID   primitive.ObjectID `bson:"_id" json:"id"`
+	Name string             `bson:"name" json:"name"`
+}
+
+// missingExercises returns the exercise IDs used by a routine that do not
+// exist or are private exercises of another user than owner. Archived
+// exercises still count as existing.
+func missingExercises(ctx context.Context, client *mongo.Client, owner primitive.ObjectID, exercises []models.RoutineExercise) ([]primitive.ObjectID, error) {
+	missing := []primitive.ObjectID{}
+	if len(exercises) == 0 {
+		return missing, nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(exercises))
+	for _, exercise := range exercises {
+		ids = append(ids, exercise.ExerciseID)
+	}
+
+	filter := bson.M{"owner_id": bson.M{"$in": []interface{}{nil, owner}}}
+	existing, err := existingExerciseIDs(ctx, client.Database("gym-app").Collection("exercises"), ids, filter)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[primitive.ObjectID]bool)
+	for _, id := range ids {
+		if !existing[id] && !seen[id] {
+			seen[id] = true
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+// checkRoutineExercises writes an error response and returns false when the
+// routine references exercises that do not exist.
+func checkRoutineExercises(ctx context.Context, c *gin.Context, client *mongo.Client, routine models.Routine) bool {
+	missing, err := missingExercises(ctx, client, routine.UserID, routine.Exercises)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Routine references exercises that do not exist", "missing_exercise_ids": missing})
+		return false
+	}
+	return true
+}
+
+// referencingRoutines returns up to maxListedReferences routines that use
+// the exercise.
+func referencingRoutines(ctx context.Context, client *mongo.Client, exerciseID primitive.ObjectID) ([]routineReference, error) {
+	collection := client.Database("gym-app").Collection("routines")
+	opts := options.Find().SetProjection(bson.M{"name": 1}).SetLimit(maxListedReferences)
+	cursor, err := collection.Find(ctx, bson.M{"exercises.exercise_id": exerciseID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	references := []routineReference{}
+	if err := cursor.All(ctx, &references); err != nil {
+		return nil, err
+	}
+	return references, nil
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gym-api/m/models"
+)
+
+// routineCSVColumns are the columns of the CSV format, one row per set.
+// Consecutive rows with the same order belong to the same exercise; without
+// an order, consecutive rows of the same exercise and group do. Drop steps
+// are written as reps@weight separated by semicolons.
+var routineCSVColumns = []string{"order", "exercise", "group", "type", "reps", "weight", "unit", "rest", "duration", "distance", "tempo", "rpe", "rir", "drops"}
+
+// parseRoutineCSV parses a routine from CSV with a header row. Only the
+// exercise column is required and the columns can be in any order.
+func parseRoutineCSV(r io.Reader) (portableRoutine, []importError) {
+	var routine portableRoutine
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return routine, []importError{{Line: 1, Error: "missing header row"}}
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(routineCSVColumns, name) {
+			return routine, []importError{{Line: 1, Error: fmt.Sprintf("unknown column %q", name)}}
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["exercise"]; !ok {
+		return routine, []importError{{Line: 1, Error: "missing exercise column"}}
+	}
+
+	var errs []importError
+	current := ""
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, importError{Line: parseErr.Line, Error: parseErr.Err.Error()})
+			} else {
+				errs = append(errs, importError{Error: err.Error()})
+			}
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		name := field("exercise")
+		if name == "" {
+			errs = append(errs, importError{Line: line, Error: "exercise is required"})
+			continue
+		}
+		set, err := parseCSVSet(field)
+		if err != nil {
+			errs = append(errs, importError{Line: line, Error: err.Error()})
+			continue
+		}
+
+		order := field("order")
+		key := "order\x00" + order
+		if order == "" {
+			key = name + "\x00" + field("group")
+		}
+		if len(routine.Exercises) == 0 || key != current {
+			routine.Exercises = append(routine.Exercises, portableExercise{Exercise: name, Group: field("group"), Line: line})
+			current = key
+		}
+		exercise := &routine.Exercises[len(routine.Exercises)-1]
+		if nameKey(exercise.Exercise) != nameKey(name) {
+			errs = append(errs, importError{Line: line, Error: fmt.Sprintf("order %s is already used by %q on line %d", order, exercise.Exercise, exercise.Line)})
+			continue
+		}
+		exercise.Sets = append(exercise.Sets, set)
+	}
+	return routine, errs
+}
+
+// parseCSVSet reads the set of a CSV row.
+func parseCSVSet(field func(string) string) (models.Set, error) {
+	set := models.Set{Type: field("type"), Unit: field("unit"), Tempo: field("tempo")}
+	ints := map[string]*int{"reps": &set.Reps, "rest": &set.Rest, "duration": &set.Duration}
+	for name, target := range ints {
+		if value := field(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return set, fmt.Errorf("%s must be a whole number, got %q", name, value)
+			}
+			*target = n
+		}
+	}
+	floats := map[string]*float64{"weight": &set.Weight, "distance": &set.Distance, "rpe": &set.RPE}
+	for name, target := range floats {
+		if value := field(name); value != "" {
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return set, fmt.Errorf("%s must be a number, got %q", name, value)
+			}
+			*target = n
+		}
+	}
+	if value := field("rir"); value != "" {
+		rir, err := strconv.Atoi(value)
+		if err != nil {
+			return set, fmt.Errorf("rir must be a whole number, got %q", value)
+		}
+		set.RIR = &rir
+	}
+	if value := field("drops"); value != "" {
+		for _, step := range strings.Split(value, ";") {
+			reps, weight, ok := strings.Cut(strings.TrimSpace(step), "@")
+			drop := models.DropStep{}
+			var err error
+			if drop.Reps, err = strconv.Atoi(strings.TrimSpace(reps)); err != nil || !ok {
+				return set, fmt.Errorf("drops must look like 8@50;6@40, got %q", value)
+			}
+			if drop.Weight, err = strconv.ParseFloat(strings.TrimSpace(weight), 64); err != nil {
+				return set, fmt.Errorf("drops must look like 8@50;6@40, got %q", value)
+			}
+			set.Drops = append(set.Drops, drop)
+		}
+	}
+	return set, nil
+}
+
+// writeRoutineCSV writes a routine as CSV with every column.
+func writeRoutineCSV(w io.Writer, routine portableRoutine) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(routineCSVColumns); err != nil {
+		return err
+	}
+	number := func(n float64) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	for i, exercise := range routine.Exercises {
+		for _, set := range exercise.Sets {
+			rir := ""
+			if set.RIR != nil {
+				rir = strconv.Itoa(*set.RIR)
+			}
+			drops := make([]string, len(set.Drops))
+			for j, drop := range set.Drops {
+				drops[j] = fmt.Sprintf("%d@%s", drop.Reps, strconv.FormatFloat(drop.Weight, 'f', -1, 64))
+			}
+			record := []string{
+				strconv.Itoa(i + 1), exercise.Exercise, exercise.Group, set.Type,
+				number(float64(set.Reps)), number(set.Weight), set.Unit, number(float64(set.Rest)),
+				number(float64(set.Duration)), number(set.Distance), set.Tempo, number(set.RPE), rir,
+				strings.Join(drops, ";"),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
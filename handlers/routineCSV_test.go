@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gym-api/m/models"
+)
+
+func TestParseRoutineCSV(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		exercises []portableExercise
+		errLines  []int
+	}{
+		{
+			name:  "rows with the same order form one exercise",
+			input: "order,exercise,reps,weight,unit\n1,Bench Press,10,40,kg\n1,Bench Press,8,60,kg\n2,Squat,5,100,kg\n",
+			exercises: []portableExercise{
+				{Exercise: "Bench Press", Line: 2, Sets: []models.Set{
+					{Reps: 10, Weight: 40, Unit: "kg"},
+					{Reps: 8, Weight: 60, Unit: "kg"},
+				}},
+				{Exercise: "Squat", Line: 4, Sets: []models.Set{{Reps: 5, Weight: 100, Unit: "kg"}}},
+			},
+		},
+		{
+			name:  "without order consecutive rows of an exercise form one exercise",
+			input: "exercise,group,reps\nDips,A,8\nDips,A,8\nPlank,A,1\nDips,,8\n",
+			exercises: []portableExercise{
+				{Exercise: "Dips", Group: "A", Line: 2, Sets: []models.Set{{Reps: 8}, {Reps: 8}}},
+				{Exercise: "Plank", Group: "A", Line: 4, Sets: []models.Set{{Reps: 1}}},
+				{Exercise: "Dips", Line: 5, Sets: []models.Set{{Reps: 8}}},
+			},
+		},
+		{
+			name:  "blank orders group by exercise",
+			input: "order,exercise,reps\n,Bench Press,8\n,Bench Press,8\n,Squat,5\n",
+			exercises: []portableExercise{
+				{Exercise: "Bench Press", Line: 2, Sets: []models.Set{{Reps: 8}, {Reps: 8}}},
+				{Exercise: "Squat", Line: 4, Sets: []models.Set{{Reps: 5}}},
+			},
+		},
+		{
+			name:     "one order for two exercises",
+			input:    "order,exercise,reps\n1,Bench Press,8\n1,Squat,5\n",
+			errLines: []int{3},
+		},
+		{
+			name:  "drops and rir",
+			input: "exercise,type,reps,weight,drops,rir\nCurl,drop,10,20,8@15;6@10,2\n",
+			exercises: []portableExercise{
+				{Exercise: "Curl", Line: 2, Sets: []models.Set{{
+					Type: "drop", Reps: 10, Weight: 20, RIR: intPointer(2),
+					Drops: []models.DropStep{{Reps: 8, Weight: 15}, {Reps: 6, Weight: 10}},
+				}}},
+			},
+		},
+		{
+			name:     "bare quote",
+			input:    "exercise,reps\nBench,10\nBench \"Press,8\n",
+			errLines: []int{3},
+		},
+		{
+			name:     "invalid number",
+			input:    "exercise,reps\nBench,ten\nSquat,5\n",
+			errLines: []int{2},
+		},
+		{
+			name:     "missing exercise",
+			input:    "exercise,reps\n,10\n",
+			errLines: []int{2},
+		},
+		{
+			name:     "unknown column",
+			input:    "exercise,weight_kg\nBench,10\n",
+			errLines: []int{1},
+		},
+		{
+			name:     "missing exercise column",
+			input:    "reps\n10\n",
+			errLines: []int{1},
+		},
+		{
+			name:     "empty input",
+			input:    "",
+			errLines: []int{1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routine, errs := parseRoutineCSV(strings.NewReader(test.input))
+			var lines []int
+			for _, err := range errs {
+				lines = append(lines, err.Line)
+			}
+			if !reflect.DeepEqual(lines, test.errLines) {
+				t.Fatalf("error lines = %v, want %v (%v)", lines, test.errLines, errs)
+			}
+			if test.errLines == nil && !reflect.DeepEqual(routine.Exercises, test.exercises) {
+				t.Errorf("exercises = %+v, want %+v", routine.Exercises, test.exercises)
+			}
+		})
+	}
+}
+
+func TestRoutineCSVRoundTrip(t *testing.T) {
+	routine := portableRoutine{Exercises: []portableExercise{
+		{Exercise: "Bench Press", Group: "A", Sets: []models.Set{
+			{Type: "warmup", Reps: 10, Weight: 40, Unit: "kg", Rest: 60},
+			{Reps: 8, Weight: 60.5, Unit: "kg", Tempo: "3-1-1-0", RPE: 8},
+		}},
+		{Exercise: "Rowing, \"indoor\"", Group: "A", Sets: []models.Set{
+			{Type: "distance", Distance: 2000, Duration: 480},
+		}},
+		{Exercise: "Curl", Sets: []models.Set{
+			{Type: "drop", Reps: 10, Weight: 20, Unit: "lb", RIR: intPointer(0), Drops: []models.DropStep{{Reps: 8, Weight: 15}}},
+		}},
+	}}
+
+	var b strings.Builder
+	if err := writeRoutineCSV(&b, routine); err != nil {
+		t.Fatal(err)
+	}
+	parsed, errs := parseRoutineCSV(strings.NewReader(b.String()))
+	if len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	for i := range parsed.Exercises {
+		parsed.Exercises[i].Line = 0
+	}
+	if !reflect.DeepEqual(parsed.Exercises, routine.Exercises) {
+		t.Errorf("round trip = %+v, want %+v", parsed.Exercises, routine.Exercises)
+	}
+}
+
+func intPointer(n int) *int {
+	return &n
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// expandedRoutine is a routine with the exercise documents of its entries,
+// returned for ?expand=exercises.
+type expandedRoutine struct {
+	models.Routine
+	Exercises []expandedRoutineExercise `json:"exercises"`
+}
+
+// expandedRoutineExercise carries the exercise an entry refers to. Missing
+// is set when the exercise no longer exists.
+type expandedRoutineExercise struct {
+	models.RoutineExercise
+	Exercise *models.Exercise `json:"exercise"`
+	Missing  bool             `json:"missing,omitempty"`
+}
+
+// expandExercises reports whether the expand query parameter asks for the
+// exercises of routines. exercises is the only expandable field.
+func expandExercises(c *gin.Context) (bool, error) {
+	expand := c.Query("expand")
+	if expand == "" {
+		return false, nil
+	}
+	for _, field := range strings.Split(expand, ",") {
+		if strings.TrimSpace(field) != "exercises" {
+			return false, errors.New("expand only supports exercises")
+		}
+	}
+	return true, nil
+}
+
+// expandRoutines looks up the exercises of routines with a $lookup
+// aggregation and returns the routines in the same order, with their
+// exercises localized for locale.
+func expandRoutines(ctx context.Context, client *mongo.Client, routines []models.Routine, locale string) ([]expandedRoutine, error) {
+	expanded := make([]expandedRoutine, 0, len(routines))
+	if len(routines) == 0 {
+		return expanded, nil
+	}
+	ids := make([]primitive.ObjectID, len(routines))
+	for i, routine := range routines {
+		ids[i] = routine.ID
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": bson.M{"$in": ids}}}},
+		{{Key: "$project", Value: bson.M{"exercises.exercise_id": 1}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "exercises",
+			"localField":   "exercises.exercise_id",
+			"foreignField": "_id",
+			"as":           "exercise_docs",
+		}}},
+	}
+	collection := client.Database("gym-app").Collection("routines")
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var lookups []struct {
+		ID           primitive.ObjectID `bson:"_id"`
+		ExerciseDocs []models.Exercise  `bson:"exercise_docs"`
+	}
+	if err := cursor.All(ctx, &lookups); err != nil {
+		return nil, err
+	}
+	exercises := make(map[primitive.ObjectID]map[primitive.ObjectID]models.Exercise)
+	for _, lookup := range lookups {
+		docs := make(map[primitive.ObjectID]models.Exercise)
+		for _, exercise := range lookup.ExerciseDocs {
+			localizeExercise(&exercise, locale)
+			docs[exercise.ID] = exercise
+		}
+		exercises[lookup.ID] = docs
+	}
+
+	for _, routine := range routines {
+		result := expandedRoutine{Routine: routine, Exercises: []expandedRoutineExercise{}}
+		for _, entry := range routine.Exercises {
+			item := expandedRoutineExercise{RoutineExercise: entry}
+			if exercise, ok := exercises[routine.ID][entry.ExerciseID]; ok {
+				item.Exercise = &exercise
+			} else {
+				item.Missing = true
+			}
+			result.Exercises = append(result.Exercises, item)
+		}
+		expanded = append(expanded, result)
+	}
+	return expanded, nil
+}
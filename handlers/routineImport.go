@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxImportBytes caps the size of an imported routine.
+const maxImportBytes = 1 << 20
+
+// routineFormats are the import and export formats.
+var routineFormats = []string{"json", "csv", "text"}
+
+// portableRoutine is a routine that refers to exercises by name, so that
+// it can be written by hand and moved between accounts.
+type portableRoutine struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Exercises   []portableExercise `json:"exercises"`
+}
+
+// portableExercise is an exercise of a portable routine. ExerciseID is
+// preferred over the name when it is set and usable by the importer. Line
+// is where the exercise starts in an imported file.
+type portableExercise struct {
+	Exercise   string              `json:"exercise"`
+	ExerciseID *primitive.ObjectID `json:"exercise_id,omitempty"`
+	Group      string              `json:"group,omitempty"`
+	Sets       []models.Set        `json:"sets"`
+	Line       int                 `json:"-"`
+}
+
+// importError is a problem with a line of an imported file.
+type importError struct {
+	Line  int    `json:"line,omitempty"`
+	Error string `json:"error"`
+}
+
+// unresolvedExercise reports an exercise name that matched no exercise of
+// the catalog, with the closest names.
+type unresolvedExercise struct {
+	Index       int      `json:"index"`
+	Line        int      `json:"line,omitempty"`
+	Exercise    string   `json:"exercise"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// resolve turns a portable routine into a routine, looking up its
+// exercises with matcher.
+func (p portableRoutine) resolve(matcher *exerciseMatcher) (models.Routine, []unresolvedExercise) {
+	routine := models.Routine{Name: p.Name, Description: p.Description, Exercises: []models.RoutineExercise{}}
+	var unresolved []unresolvedExercise
+	for i, exercise := range p.Exercises {
+		entry := models.RoutineExercise{Order: i + 1, Group: exercise.Group, Sets: exercise.Sets}
+		if exercise.ExerciseID != nil && matcher.has(*exercise.ExerciseID) {
+			entry.ExerciseID = *exercise.ExerciseID
+		} else if id, suggestions, ok := matcher.match(exercise.Exercise); ok {
+			entry.ExerciseID = id
+		} else {
+			unresolved = append(unresolved, unresolvedExercise{Index: i, Line: exercise.Line, Exercise: exercise.Exercise, Suggestions: suggestions})
+		}
+		routine.Exercises = append(routine.Exercises, entry)
+	}
+	return routine, unresolved
+}
+
+// requestFormat returns the format query parameter, else the format of the
+// Content-Type, else fallback.
+func requestFormat(c *gin.Context, fallback string) (string, bool) {
+	format := c.Query("format")
+	if format == "" {
+		switch c.ContentType() {
+		case "application/json":
+			format = "json"
+		case "text/csv":
+			format = "csv"
+		case "text/plain":
+			format = "text"
+		default:
+			format = fallback
+		}
+	}
+	format, err := enumValue("format", format, routineFormats)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return format, true
+}
+
+// ImportRoutine creates a routine from JSON, CSV or the shorthand notation.
+// Exercise names are matched against the catalog and the response lists
+// every name that could not be resolved. ?name= names the routine and
+// ?dry_run=true returns the routine without storing it.
+func (h *RoutineHandler) ImportRoutine(c *gin.Context) {
+	format, ok := requestFormat(c, "text")
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+
+	var portable portableRoutine
+	var errs []importError
+	switch format {
+	case "json":
+		if err := json.Unmarshal(body, &portable); err != nil {
+			errs = []importError{{Error: err.Error()}}
+		}
+	case "csv":
+		portable, errs = parseRoutineCSV(bytes.NewReader(body))
+	case "text":
+		portable, errs = parseNotation(string(body))
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Routine could not be read", "lines": errs})
+		return
+	}
+	if name := c.Query("name"); name != "" {
+		portable.Name = name
+	}
+
+	collection := h.DB.Database("gym-app").Collection("routines")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Imported routines are owned by the user who imports them
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+	matcher, err := newExerciseMatcher(ctx, h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	routine, unresolved := portable.resolve(matcher)
+	if len(unresolved) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Some exercises could not be resolved", "unresolved": unresolved})
+		return
+	}
+	routine.UserID = userID
+
+	if c.Query("dry_run") == "true" {
+		if !checkRoutine(c, &routine, units.Unit) || !checkRoutineExercises(ctx, c, h.DB, routine) {
+			return
+		}
+		routine.Exercises = displayWeights(normalizeWeights(routine.Exercises, units), units, false)
+		c.JSON(http.StatusOK, routine)
+		return
+	}
+	h.insertRoutine(ctx, c, collection, routine, units)
+}
+
+// ExportRoutine writes a routine the caller can read as JSON, CSV or the
+// shorthand notation, with exercises named and weights in the request
+// unit. Routines the notation cannot express are rejected with 422.
+func (h *RoutineHandler) ExportRoutine(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	format, err := enumValue("format", c.DefaultQuery("format", "json"), routineFormats)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	database := h.DB.Database("gym-app")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+	filter := h.readFilter(c)
+	filter["_id"] = objectID
+	var routine models.Routine
+	err = database.Collection("routines").FindOne(ctx, filter).Decode(&routine)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ids := make([]primitive.ObjectID, len(routine.Exercises))
+	for i, entry := range routine.Exercises {
+		ids[i] = entry.ExerciseID
+	}
+	exercises, err := findExercises(ctx, database.Collection("exercises"), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	portable := portableRoutine{Name: routine.Name, Description: routine.Description, Exercises: []portableExercise{}}
+	for _, entry := range displayWeights(routine.Exercises, units, false) {
+		id := entry.ExerciseID
+		portable.Exercises = append(portable.Exercises, portableExercise{
+			Exercise:   exercises[id].Exercise,
+			ExerciseID: &id,
+			Group:      entry.Group,
+			Sets:       entry.Sets,
+		})
+	}
+
+	filename := strings.ReplaceAll(nameKey(routine.Name), " ", "-")
+	if filename == "" {
+		filename = "routine"
+	}
+	extensions := map[string]string{"json": ".json", "csv": ".csv", "text": ".txt"}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + extensions[format]}))
+
+	switch format {
+	case "json":
+		c.JSON(http.StatusOK, portable)
+	case "csv":
+		var b bytes.Buffer
+		if err := writeRoutineCSV(&b, portable); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", b.Bytes())
+	case "text":
+		text, err := formatNotation(portable)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(text))
+	}
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gym-api/m/models"
+)
+
+// The shorthand notation has one exercise per line, such as
+//
+//	# Push day
+//	Bench Press 1x10 @ 40kg, 4x8 @ 60kg, rest 90s
+//	A1) Dips 3xAMRAP
+//	A2) Plank 3x60s
+//	Rowing 1x2000m, rpe 7
+//
+// A "# " line names the routine. Each line is an exercise name followed by
+// comma separated set specs and options. A set spec is sets x work, where
+// work is reps, AMRAP, a time in s or min, or a distance in m or km,
+// optionally followed by @ weight and kg or lb. Options are rest, rpe, rir
+// and tempo and apply to every set of the line. A prefix like A1) puts the
+// exercise in superset or circuit group A. Lines starting with // are
+// comments.
+var (
+	notationGroup   = regexp.MustCompile(`^([A-Za-z])\d+[.)]\s+`)
+	notationSetSpec = regexp.MustCompile(`(?i)^(\d+)\s*x\s*(amrap|\d+(?:\.\d+)?\s*(?:s|sec|min|m|km)?)(?:\s*@\s*(\d+(?:\.\d+)?)\s*(kg|lbs?)?)?$`)
+	notationFirst   = regexp.MustCompile(`(?i)^(.+?)\s+(\d+\s*x\s*.+)$`)
+	notationOption  = regexp.MustCompile(`(?i)^(rest|rpe|rir|tempo)\s+(\S+?)\s*(s|sec|min)?$`)
+)
+
+// maxNotationSets caps the sets count of one set spec.
+const maxNotationSets = maxSetsPerExercise
+
+// parseNotation parses a routine written in the shorthand notation.
+func parseNotation(text string) (portableRoutine, []importError) {
+	var routine portableRoutine
+	var errs []importError
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "//"):
+			continue
+		case strings.HasPrefix(line, "#"):
+			if routine.Name == "" {
+				routine.Name = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			}
+			continue
+		}
+
+		exercise, err := parseNotationLine(line)
+		if err != nil {
+			errs = append(errs, importError{Line: number, Error: err.Error()})
+			continue
+		}
+		exercise.Line = number
+		routine.Exercises = append(routine.Exercises, exercise)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, importError{Error: err.Error()})
+	}
+	return routine, errs
+}
+
+func parseNotationLine(line string) (portableExercise, error) {
+	var exercise portableExercise
+	if group := notationGroup.FindStringSubmatch(line); group != nil {
+		exercise.Group = strings.ToUpper(group[1])
+		line = line[len(group[0]):]
+	}
+
+	parts := strings.Split(line, ",")
+	first := notationFirst.FindStringSubmatch(strings.TrimSpace(parts[0]))
+	if first == nil {
+		return exercise, fmt.Errorf("expected an exercise name followed by sets such as 3x8, got %q", line)
+	}
+	exercise.Exercise = strings.TrimSpace(first[1])
+	parts[0] = first[2]
+
+	var options []string
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		spec := notationSetSpec.FindStringSubmatch(part)
+		if spec == nil {
+			options = append(options, part)
+			continue
+		}
+		sets, err := parseSetSpec(spec)
+		if err != nil {
+			return exercise, err
+		}
+		exercise.Sets = append(exercise.Sets, sets...)
+	}
+	for _, option := range options {
+		if err := applyNotationOption(exercise.Sets, option); err != nil {
+			return exercise, err
+		}
+	}
+	return exercise, nil
+}
+
+// parseSetSpec turns a matched set spec into its sets.
+func parseSetSpec(spec []string) ([]models.Set, error) {
+	count, _ := strconv.Atoi(spec[1])
+	if count < 1 || count > maxNotationSets {
+		return nil, fmt.Errorf("%q must have between 1 and %d sets", spec[0], maxNotationSets)
+	}
+
+	var set models.Set
+	work := strings.ToLower(strings.ReplaceAll(spec[2], " ", ""))
+	number := strings.TrimRight(work, "sceminkx")
+	value, _ := strconv.ParseFloat(number, 64)
+	switch suffix := work[len(number):]; {
+	case work == "amrap":
+		set.Type = models.SetAMRAP
+	case suffix == "":
+		if value != float64(int(value)) {
+			return nil, fmt.Errorf("%q must have a whole number of reps", spec[0])
+		}
+		set.Reps = int(value)
+	case suffix == "s" || suffix == "sec":
+		set.Type, set.Duration = models.SetTimed, int(value)
+	case suffix == "min":
+		set.Type, set.Duration = models.SetTimed, int(value*60)
+	case suffix == "m":
+		set.Type, set.Distance = models.SetDistance, value
+	case suffix == "km":
+		set.Type, set.Distance = models.SetDistance, value*1000
+	}
+
+	if spec[3] != "" {
+		set.Weight, _ = strconv.ParseFloat(spec[3], 64)
+	}
+	switch strings.ToLower(spec[4]) {
+	case "kg":
+		set.Unit = models.UnitKg
+	case "lb", "lbs":
+		set.Unit = models.UnitLb
+	}
+
+	sets := make([]models.Set, count)
+	for i := range sets {
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+// applyNotationOption applies an option such as "rest 90s" to sets.
+func applyNotationOption(sets []models.Set, option string) error {
+	match := notationOption.FindStringSubmatch(option)
+	if match == nil {
+		return fmt.Errorf("unknown set or option %q", option)
+	}
+	value := match[2]
+	for i := range sets {
+		switch strings.ToLower(match[1]) {
+		case "rest":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("rest must be a number of seconds, got %q", value)
+			}
+			if strings.ToLower(match[3]) == "min" {
+				seconds *= 60
+			}
+			sets[i].Rest = int(seconds)
+		case "rpe":
+			rpe, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("rpe must be a number, got %q", value)
+			}
+			sets[i].RPE = rpe
+		case "rir":
+			rir, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("rir must be a number, got %q", value)
+			}
+			sets[i].RIR = &rir
+		case "tempo":
+			sets[i].Tempo = strings.ToUpper(value)
+		}
+	}
+	return nil
+}
+
+// formatNotation writes a routine in the shorthand notation. Consecutive
+// equal sets are written as one spec; options are written when all sets of
+// an exercise share them. The notation has no warm-up or drop sets, so
+// they are written as normal sets, drop sets without their drop steps. It
+// returns an error when the routine has more groups than there are group
+// letters, or an exercise name that would not be read back as written,
+// e.g. one with a comma.
+func formatNotation(routine portableRoutine) (string, error) {
+	var b strings.Builder
+	if routine.Name != "" {
+		fmt.Fprintf(&b, "# %s\n", routine.Name)
+	}
+
+	labels := make(map[string]string)
+	counts := make(map[string]int)
+	for _, exercise := range routine.Exercises {
+		var line strings.Builder
+		if exercise.Group != "" {
+			if _, ok := labels[exercise.Group]; !ok {
+				if len(labels) == 26 {
+					return "", fmt.Errorf("the notation has at most 26 groups")
+				}
+				labels[exercise.Group] = string(rune('A' + len(labels)))
+			}
+			counts[exercise.Group]++
+			fmt.Fprintf(&line, "%s%d) ", labels[exercise.Group], counts[exercise.Group])
+		}
+		line.WriteString(exercise.Exercise)
+
+		var specs []string
+		for i := 0; i < len(exercise.Sets); {
+			j := i + 1
+			for j < len(exercise.Sets) && sameWork(exercise.Sets[i], exercise.Sets[j]) {
+				j++
+			}
+			specs = append(specs, formatSetSpec(j-i, exercise.Sets[i]))
+			i = j
+		}
+		line.WriteString(" " + strings.Join(specs, ", "))
+		for _, option := range commonOptions(exercise.Sets) {
+			line.WriteString(", " + option)
+		}
+
+		parsed, errs := parseNotation(line.String())
+		if len(errs) > 0 || len(parsed.Exercises) != 1 || parsed.Exercises[0].Exercise != exercise.Exercise {
+			return "", fmt.Errorf("exercise %q cannot be written in the notation", exercise.Exercise)
+		}
+		b.WriteString(line.String() + "\n")
+	}
+	return b.String(), nil
+}
+
+// sameWork reports whether two sets are written as the same set spec.
+func sameWork(a, b models.Set) bool {
+	return a.Type == b.Type && a.Reps == b.Reps && a.Duration == b.Duration &&
+		a.Distance == b.Distance && a.Weight == b.Weight && a.Unit == b.Unit
+}
+
+func formatSetSpec(count int, set models.Set) string {
+	var work string
+	switch set.Type {
+	case models.SetAMRAP:
+		work = "AMRAP"
+	case models.SetTimed:
+		work = fmt.Sprintf("%ds", set.Duration)
+	case models.SetDistance:
+		work = strconv.FormatFloat(set.Distance, 'f', -1, 64) + "m"
+	default:
+		work = strconv.Itoa(set.Reps)
+	}
+	spec := fmt.Sprintf("%dx%s", count, work)
+	if set.Weight > 0 {
+		spec += " @ " + strconv.FormatFloat(set.Weight, 'f', -1, 64) + set.Unit
+	}
+	return spec
+}
+
+// commonOptions returns the options shared by all sets.
+func commonOptions(sets []models.Set) []string {
+	if len(sets) == 0 {
+		return nil
+	}
+	first := sets[0]
+	same := func(equal func(a, b models.Set) bool) bool {
+		for _, set := range sets[1:] {
+			if !equal(first, set) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var options []string
+	if first.Rest > 0 && same(func(a, b models.Set) bool { return a.Rest == b.Rest }) {
+		options = append(options, fmt.Sprintf("rest %ds", first.Rest))
+	}
+	if first.RPE > 0 && same(func(a, b models.Set) bool { return a.RPE == b.RPE }) {
+		options = append(options, "rpe "+strconv.FormatFloat(first.RPE, 'f', -1, 64))
+	}
+	if first.RIR != nil && same(func(a, b models.Set) bool { return b.RIR != nil && *a.RIR == *b.RIR }) {
+		options = append(options, fmt.Sprintf("rir %d", *first.RIR))
+	}
+	if first.Tempo != "" && same(func(a, b models.Set) bool { return a.Tempo == b.Tempo }) {
+		options = append(options, "tempo "+first.Tempo)
+	}
+	return options
+}
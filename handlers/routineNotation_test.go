@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"gym-api/m/models"
+)
+
+func TestParseNotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		routine  portableRoutine
+		errLines []int
+	}{
+		{
+			name: "name, sets and options",
+			input: "# Push day\n" +
+				"// warm up first\n" +
+				"Bench Press 1x10 @ 40kg, 2x8 @ 60kg, rest 90s\n" +
+				"\n" +
+				"Overhead Press 3x5 @ 95 lbs, rpe 8, tempo 3-1-1-0\n",
+			routine: portableRoutine{Name: "Push day", Exercises: []portableExercise{
+				{Exercise: "Bench Press", Line: 3, Sets: []models.Set{
+					{Reps: 10, Weight: 40, Unit: "kg", Rest: 90},
+					{Reps: 8, Weight: 60, Unit: "kg", Rest: 90},
+					{Reps: 8, Weight: 60, Unit: "kg", Rest: 90},
+				}},
+				{Exercise: "Overhead Press", Line: 5, Sets: []models.Set{
+					{Reps: 5, Weight: 95, Unit: "lb", RPE: 8, Tempo: "3-1-1-0"},
+					{Reps: 5, Weight: 95, Unit: "lb", RPE: 8, Tempo: "3-1-1-0"},
+					{Reps: 5, Weight: 95, Unit: "lb", RPE: 8, Tempo: "3-1-1-0"},
+				}},
+			}},
+		},
+		{
+			name:  "groups and set types",
+			input: "A1) Dips 2xAMRAP, rir 1\na2. Plank 1x1.5min\nRowing 1x2km\n",
+			routine: portableRoutine{Exercises: []portableExercise{
+				{Exercise: "Dips", Group: "A", Line: 1, Sets: []models.Set{
+					{Type: models.SetAMRAP, RIR: intPointer(1)},
+					{Type: models.SetAMRAP, RIR: intPointer(1)},
+				}},
+				{Exercise: "Plank", Group: "A", Line: 2, Sets: []models.Set{{Type: models.SetTimed, Duration: 90}}},
+				{Exercise: "Rowing", Line: 3, Sets: []models.Set{{Type: models.SetDistance, Distance: 2000}}},
+			}},
+		},
+		{
+			name:     "every invalid line is reported",
+			input:    "Bench Press\nSquat 3x5\nCurl 3x8, rest soon\nDips 0x8\nPress 3x7.5\nRow 3x8, hold 2s\n",
+			errLines: []int{1, 3, 4, 5, 6},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routine, errs := parseNotation(test.input)
+			var lines []int
+			for _, err := range errs {
+				lines = append(lines, err.Line)
+			}
+			if !reflect.DeepEqual(lines, test.errLines) {
+				t.Fatalf("error lines = %v, want %v (%v)", lines, test.errLines, errs)
+			}
+			if test.errLines == nil && !reflect.DeepEqual(routine, test.routine) {
+				t.Errorf("routine = %+v, want %+v", routine, test.routine)
+			}
+		})
+	}
+}
+
+func TestParseSetSpec(t *testing.T) {
+	tests := []struct {
+		spec  string
+		sets  int
+		set   models.Set
+		valid bool
+	}{
+		{spec: "3x8", sets: 3, set: models.Set{Reps: 8}, valid: true},
+		{spec: "3 X 8 @ 62.5 kg", sets: 3, set: models.Set{Reps: 8, Weight: 62.5, Unit: "kg"}, valid: true},
+		{spec: "1x225@lb", valid: false},
+		{spec: "5x20@100lb", sets: 5, set: models.Set{Reps: 20, Weight: 100, Unit: "lb"}, valid: true},
+		{spec: "2xamrap", sets: 2, set: models.Set{Type: models.SetAMRAP}, valid: true},
+		{spec: "3x45sec", sets: 3, set: models.Set{Type: models.SetTimed, Duration: 45}, valid: true},
+		{spec: "1x2min", sets: 1, set: models.Set{Type: models.SetTimed, Duration: 120}, valid: true},
+		{spec: "1x400m", sets: 1, set: models.Set{Type: models.SetDistance, Distance: 400}, valid: true},
+		{spec: "1x5km", sets: 1, set: models.Set{Type: models.SetDistance, Distance: 5000}, valid: true},
+		{spec: "0x8", valid: false},
+		{spec: "21x8", valid: false},
+		{spec: "3x8.5", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			match := notationSetSpec.FindStringSubmatch(test.spec)
+			if match == nil {
+				if test.valid {
+					t.Fatalf("%q does not match the set spec pattern", test.spec)
+				}
+				return
+			}
+			sets, err := parseSetSpec(match)
+			if (err == nil) != test.valid {
+				t.Fatalf("error = %v, want valid %v", err, test.valid)
+			}
+			if !test.valid {
+				return
+			}
+			if len(sets) != test.sets {
+				t.Fatalf("got %d sets, want %d", len(sets), test.sets)
+			}
+			for _, set := range sets {
+				if !reflect.DeepEqual(set, test.set) {
+					t.Errorf("set = %+v, want %+v", set, test.set)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatNotationRoundTrip(t *testing.T) {
+	tests := []portableRoutine{
+		{Name: "Push day", Exercises: []portableExercise{
+			{Exercise: "Bench Press", Sets: []models.Set{
+				{Reps: 10, Weight: 40, Unit: "kg", Rest: 90},
+				{Reps: 8, Weight: 60.5, Unit: "kg", Rest: 90},
+				{Reps: 8, Weight: 60.5, Unit: "kg", Rest: 90},
+			}},
+			{Exercise: "Dips", Group: "superset", Sets: []models.Set{
+				{Type: models.SetAMRAP, RPE: 9.5},
+			}},
+			{Exercise: "Plank", Group: "superset", Sets: []models.Set{
+				{Type: models.SetTimed, Duration: 60, RIR: intPointer(0)},
+			}},
+			{Exercise: "Curl", Group: "arms", Sets: []models.Set{{Reps: 12}}},
+			{Exercise: "Pushdown", Group: "arms", Sets: []models.Set{{Reps: 12}}},
+			{Exercise: "Rowing", Sets: []models.Set{
+				{Type: models.SetDistance, Distance: 500, Tempo: "2-0-X-0"},
+			}},
+		}},
+		{Exercises: []portableExercise{
+			{Exercise: "Squat", Sets: []models.Set{{Reps: 5, Weight: 225, Unit: "lb"}}},
+		}},
+	}
+
+	for _, routine := range tests {
+		t.Run(routine.Name, func(t *testing.T) {
+			text, err := formatNotation(routine)
+			if err != nil {
+				t.Fatalf("formatNotation() error = %v", err)
+			}
+			parsed, errs := parseNotation(text)
+			if len(errs) > 0 {
+				t.Fatalf("parse errors for %q: %v", text, errs)
+			}
+			// Group names are written as letters in order of appearance
+			want := routine
+			want.Exercises = append([]portableExercise(nil), routine.Exercises...)
+			labels := make(map[string]string)
+			for i := range want.Exercises {
+				if group := want.Exercises[i].Group; group != "" {
+					if _, ok := labels[group]; !ok {
+						labels[group] = string(rune('A' + len(labels)))
+					}
+					want.Exercises[i].Group = labels[group]
+				}
+				parsed.Exercises[i].Line = 0
+			}
+			if !reflect.DeepEqual(parsed, want) {
+				t.Errorf("round trip of %q = %+v, want %+v", text, parsed, want)
+			}
+		})
+	}
+}
+
+func TestFormatNotationErrors(t *testing.T) {
+	sets := []models.Set{{Reps: 8}}
+	var groups []portableExercise
+	for i := 0; i < 27; i++ {
+		groups = append(groups, portableExercise{Exercise: "Squat", Group: strconv.Itoa(i), Sets: sets})
+	}
+
+	tests := []struct {
+		name      string
+		exercises []portableExercise
+	}{
+		{"comma in name", []portableExercise{{Exercise: "Press, seated", Sets: sets}}},
+		{"group prefix in name", []portableExercise{{Exercise: "A1) Press", Sets: sets}}},
+		{"comment in name", []portableExercise{{Exercise: "// Press", Sets: sets}}},
+		{"set spec in name", []portableExercise{{Exercise: "Press 3x8", Sets: sets}}},
+		{"too many groups", groups},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := formatNotation(portableRoutine{Exercises: tt.exercises})
+			if err == nil {
+				t.Errorf("formatNotation() = %q, want an error", text)
+			}
+		})
+	}
+}
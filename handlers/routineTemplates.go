@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// coachRole is the casbin role allowed to publish routine templates, next
+// to admins.
+const coachRole = "coach"
+
+// templateFilter matches the routine templates the caller can see: public
+// templates, templates restricted to one of the caller's roles and the
+// caller's own templates. Admins see all templates.
+func (h *RoutineHandler) templateFilter(c *gin.Context) bson.M {
+	filter := bson.M{"template": bson.M{"$exists": true}}
+	roles := callerRoles(c, h.Enforcer)
+	if hasRole(roles, adminRole) {
+		return filter
+	}
+	visible := []bson.M{{"template.visibility": "public"}}
+	if len(roles) > 0 {
+		visible = append(visible, bson.M{"template.roles": bson.M{"$in": roles}})
+	}
+	if userID, err := userIDFromContext(c); err == nil {
+		visible = append(visible, bson.M{"user_id": userID})
+	}
+	filter["$or"] = visible
+	return filter
+}
+
+// readFilter matches the routines the caller can read: their own routines
+// and the templates they can see.
+func (h *RoutineHandler) readFilter(c *gin.Context) bson.M {
+	if isAdmin(c, h.Enforcer) {
+		return bson.M{}
+	}
+	templates := h.templateFilter(c)
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		return templates
+	}
+	return bson.M{"$or": []bson.M{{"user_id": userID}, templates}}
+}
+
+// checkRoutineTemplate writes an error response and returns false when the
+// caller may not publish the routine as a template. Only coaches and admins
+// can publish or change a template, and templates can only use exercises
+// from the global catalog so that everyone who clones them can see them.
+func (h *RoutineHandler) checkRoutineTemplate(ctx context.Context, c *gin.Context, previous *models.RoutineTemplate, routine models.Routine) bool {
+	if routine.Template == nil {
+		return true
+	}
+	if !reflect.DeepEqual(previous, routine.Template) && !hasRole(callerRoles(c, h.Enforcer), adminRole, coachRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only coaches can publish routine templates"})
+		return false
+	}
+	private, err := missingExercises(ctx, h.DB, primitive.NilObjectID, routine.Exercises)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(private) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Templates can only use exercises from the global catalog", "private_exercise_ids": private})
+		return false
+	}
+	return true
+}
+
+// GetTemplates lists the routine templates the caller can see. focus
+// matches the template focus and min_minutes and max_minutes filter on the
+// estimated duration.
+func (h *RoutineHandler) GetTemplates(c *gin.Context) {
+	query, err := parseListQuery(c, models.Routine{}, "name", "created_at", "updated_at", "estimated_minutes")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expand, err := expandExercises(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := h.templateFilter(c)
+	if focus := c.Query("focus"); focus != "" {
+		filter["template.focus"] = bson.M{"$regex": focus, "$options": "i"}
+	}
+	minutes := bson.M{}
+	for param, operator := range map[string]string{"min_minutes": "$gte", "max_minutes": "$lte"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a non-negative number of minutes"})
+			return
+		}
+		minutes[operator] = n
+	}
+	if len(minutes) > 0 {
+		filter["estimated_minutes"] = minutes
+	}
+
+	collection := h.DB.Database("gym-app").Collection("routines")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	var routines []models.Routine
+	if err := findPage(ctx, c, collection, filter, query, &routines); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	displayRoutines(routines, units)
+
+	var results interface{} = routines
+	if expand {
+		if results, err = h.expand(ctx, c, routines); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	response, err := query.project(results)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CloneRoutine copies a template the caller can see into their own
+// routines. The copy is a private routine linked to its template by
+// source_template_id, and can be renamed with an optional {"name": ...}
+// body.
+func (h *RoutineHandler) CloneRoutine(c *gin.Context) {
+	id := c.Param("id")
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("routines")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	filter := h.templateFilter(c)
+	filter["_id"] = objectID
+	var template models.Routine
+	err = collection.FindOne(ctx, filter).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// mapSets copies the sets so the clone shares nothing with the template
+	routine := models.Routine{
+		Name:             template.Name,
+		Description:      template.Description,
+		Exercises:        mapSets(template.Exercises, func(set models.Set) models.Set { return set }),
+		UserID:           userID,
+		SourceTemplateID: &template.ID,
+	}
+	if body.Name != "" {
+		routine.Name = body.Name
+	}
+	// The template's weights are stored in kilograms
+	if !checkRoutine(c, &routine, models.UnitKg) || !checkRoutineExercises(ctx, c, h.DB, routine) {
+		return
+	}
+	routine.CreatedAt = time.Now()
+	routine.UpdatedAt = routine.CreatedAt
+
+	result, err := collection.InsertOne(ctx, routine)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	routine.ID = result.InsertedID.(primitive.ObjectID)
+	routine.Exercises = displayWeights(routine.Exercises, units, false)
+	c.JSON(http.StatusOK, routine)
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on the structure of a routine.
+const (
+	maxRoutineNameLength        = 100
+	maxRoutineDescriptionLength = 2000
+	maxRoutineExercises         = 50
+	maxSetsPerExercise          = 20
+	maxReps                     = 1000
+	maxWeight                   = 1000.0 // kg
+	maxRestSeconds              = 3600
+	maxTemplateRoles            = 10
+	maxTemplateFocusLength      = 50
+	maxDropSteps                = 5
+	maxSetDuration              = 3600
+	maxSetDistance              = 100000.0
+	maxRIR                      = 10
+	maxGroupLength              = 50
+)
+
+// tempoPattern matches a tempo such as "3-1-1-0" or "2-0-X-0".
+var tempoPattern = regexp.MustCompile(`^[0-9X]-[0-9X]-[0-9X]-[0-9X]$`)
+
+// Assumptions used to estimate how long a routine takes.
+const (
+	secondsPerRep         = 3
+	exerciseChangeSeconds = 60
+)
+
+// fieldError reports a problem with one field of a request body. Field is
+// a path such as "exercises[2].sets[0].reps".
+type fieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// checkRoutine validates a routine and writes an error response listing
+// every invalid field when it fails. With ?renumber=true the exercises are
+// renumbered 1..n by their current order instead of order being checked.
+// A valid routine gets its estimated duration filled in. Weights without a
+// unit are in unit.
+func checkRoutine(c *gin.Context, routine *models.Routine, unit string) bool {
+	if c.Query("renumber") == "true" {
+		renumberRoutine(routine)
+	}
+	errs := validateRoutine(routine, unit)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Routine is invalid", "fields": errs})
+		return false
+	}
+	routine.EstimatedMinutes = estimateMinutes(routine)
+	return true
+}
+
+// validateRoutine checks the ranges of a routine, its exercises and sets,
+// and that the exercise orders are 1..n without duplicates or gaps.
+func validateRoutine(routine *models.Routine, unit string) []fieldError {
+	var errs []fieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, fieldError{Field: field, Error: fmt.Sprintf(format, args...)})
+	}
+
+	routine.Name = strings.TrimSpace(routine.Name)
+	if routine.Name == "" {
+		add("name", "is required")
+	} else if len(routine.Name) > maxRoutineNameLength {
+		add("name", "must be at most %d characters", maxRoutineNameLength)
+	}
+	if len(routine.Description) > maxRoutineDescriptionLength {
+		add("description", "must be at most %d characters", maxRoutineDescriptionLength)
+	}
+	if len(routine.Exercises) > maxRoutineExercises {
+		add("exercises", "must have at most %d exercises", maxRoutineExercises)
+	}
+
+	orders := make(map[int]int)
+	for i, exercise := range routine.Exercises {
+		path := fmt.Sprintf("exercises[%d]", i)
+		if exercise.ExerciseID.IsZero() {
+			add(path+".exercise_id", "is required")
+		}
+		if exercise.Order < 1 || exercise.Order > len(routine.Exercises) {
+			add(path+".order", "must be between 1 and %d", len(routine.Exercises))
+		} else if first, ok := orders[exercise.Order]; ok {
+			add(path+".order", "duplicates the order of exercises[%d]", first)
+		} else {
+			orders[exercise.Order] = i
+		}
+
+		if len(exercise.Sets) == 0 {
+			add(path+".sets", "must have at least one set")
+		} else if len(exercise.Sets) > maxSetsPerExercise {
+			add(path+".sets", "must have at most %d sets", maxSetsPerExercise)
+		}
+		for j := range exercise.Sets {
+			validateSet(add, fmt.Sprintf("%s.sets[%d]", path, j), &exercise.Sets[j], unit)
+		}
+
+		if len(exercise.Group) > maxGroupLength {
+			add(path+".group", "must be at most %d characters", maxGroupLength)
+		}
+	}
+	if len(errs) == 0 {
+		validateGroups(add, routine.Exercises)
+	}
+
+	if template := routine.Template; template != nil {
+		template.Focus = strings.TrimSpace(template.Focus)
+		if len(template.Focus) > maxTemplateFocusLength {
+			add("template.focus", "must be at most %d characters", maxTemplateFocusLength)
+		}
+		switch template.Visibility {
+		case "public":
+			template.Roles = nil
+		case "roles":
+			if len(template.Roles) == 0 {
+				add("template.roles", "must have at least one role")
+			} else if len(template.Roles) > maxTemplateRoles {
+				add("template.roles", "must have at most %d roles", maxTemplateRoles)
+			}
+			for i, role := range template.Roles {
+				template.Roles[i] = strings.TrimSpace(role)
+				if template.Roles[i] == "" {
+					add(fmt.Sprintf("template.roles[%d]", i), "must not be empty")
+				}
+			}
+		default:
+			add("template.visibility", "must be one of %s", strings.Join(models.TemplateVisibilities, ", "))
+		}
+	}
+	return errs
+}
+
+// validateSet checks the fields of a set that apply to its type and that
+// the others are not set. Sets without a type are normal sets, and sets
+// without a unit are in unit.
+func validateSet(add func(field, format string, args ...interface{}), path string, set *models.Set, unit string) {
+	setType := models.SetNormal
+	if set.Type != "" {
+		value, err := enumValue("type", set.Type, models.SetTypes)
+		if err != nil {
+			add(path+".type", "must be one of %s", strings.Join(models.SetTypes, ", "))
+			return
+		}
+		set.Type, setType = value, value
+	}
+
+	switch setType {
+	case models.SetTimed, models.SetDistance:
+		if set.Reps != 0 {
+			add(path+".reps", "is not allowed for %s sets", setType)
+		}
+		if set.Tempo != "" {
+			add(path+".tempo", "is not allowed for %s sets", setType)
+		}
+	case models.SetAMRAP:
+		if set.Reps < 0 || set.Reps > maxReps {
+			add(path+".reps", "must be between 0 and %d", maxReps)
+		}
+	default:
+		if set.Reps < 1 || set.Reps > maxReps {
+			add(path+".reps", "must be between 1 and %d", maxReps)
+		}
+	}
+	if set.Unit != "" {
+		value, err := enumValue("unit", set.Unit, models.WeightUnits)
+		if err != nil {
+			add(path+".unit", "must be one of %s", strings.Join(models.WeightUnits, ", "))
+		} else {
+			unit = value
+		}
+		set.Unit = value
+	}
+	if limit := weightLimit(unit); set.Weight < 0 || set.Weight > limit {
+		add(path+".weight", "must be between 0 and %g %s", limit, unit)
+	}
+	if set.Rest < 0 || set.Rest > maxRestSeconds {
+		add(path+".rest", "must be between 0 and %d seconds", maxRestSeconds)
+	}
+
+	if setType == models.SetDrop {
+		if len(set.Drops) == 0 || len(set.Drops) > maxDropSteps {
+			add(path+".drops", "must have between 1 and %d drops", maxDropSteps)
+		}
+		previous := set.Weight
+		for i, drop := range set.Drops {
+			dropPath := fmt.Sprintf("%s.drops[%d]", path, i)
+			if drop.Reps < 1 || drop.Reps > maxReps {
+				add(dropPath+".reps", "must be between 1 and %d", maxReps)
+			}
+			if drop.Weight < 0 || drop.Weight >= previous {
+				add(dropPath+".weight", "must be lower than the weight before it")
+			}
+			previous = drop.Weight
+		}
+	} else if len(set.Drops) > 0 {
+		add(path+".drops", "is only allowed for drop sets")
+	}
+
+	switch setType {
+	case models.SetTimed:
+		if set.Duration < 1 || set.Duration > maxSetDuration {
+			add(path+".duration", "must be between 1 and %d seconds", maxSetDuration)
+		}
+	case models.SetDistance:
+		if set.Duration < 0 || set.Duration > maxSetDuration {
+			add(path+".duration", "must be between 0 and %d seconds", maxSetDuration)
+		}
+	default:
+		if set.Duration != 0 {
+			add(path+".duration", "is only allowed for timed and distance sets")
+		}
+	}
+	if setType == models.SetDistance {
+		if set.Distance <= 0 || set.Distance > maxSetDistance {
+			add(path+".distance", "must be more than 0 and at most %g meters", maxSetDistance)
+		}
+	} else if set.Distance != 0 {
+		add(path+".distance", "is only allowed for distance sets")
+	}
+
+	if set.Tempo != "" && !tempoPattern.MatchString(set.Tempo) {
+		add(path+".tempo", "must look like 3-1-1-0, with X for explosive")
+	}
+	if set.RPE != 0 && (set.RPE < 1 || set.RPE > 10 || math.Mod(set.RPE*2, 1) != 0) {
+		add(path+".rpe", "must be between 1 and 10 in steps of 0.5")
+	}
+	if set.RIR != nil {
+		if *set.RIR < 0 || *set.RIR > maxRIR {
+			add(path+".rir", "must be between 0 and %d", maxRIR)
+		} else if set.RPE != 0 {
+			add(path+".rir", "cannot be combined with rpe")
+		}
+	}
+}
+
+// validateGroups checks that every superset or circuit group has at least
+// two exercises and that they follow each other in the routine order.
+func validateGroups(add func(field, format string, args ...interface{}), exercises []models.RoutineExercise) {
+	type group struct {
+		first, min, max, count int
+	}
+	groups := make(map[string]*group)
+	var names []string
+	for i, exercise := range exercises {
+		if exercise.Group == "" {
+			continue
+		}
+		g, ok := groups[exercise.Group]
+		if !ok {
+			g = &group{first: i, min: exercise.Order, max: exercise.Order}
+			groups[exercise.Group] = g
+			names = append(names, exercise.Group)
+		}
+		g.min = min(g.min, exercise.Order)
+		g.max = max(g.max, exercise.Order)
+		g.count++
+	}
+	for _, name := range names {
+		g := groups[name]
+		path := fmt.Sprintf("exercises[%d].group", g.first)
+		if g.count < 2 {
+			add(path, "group %q must have at least two exercises", name)
+		} else if g.max-g.min+1 != g.count {
+			add(path, "the exercises of group %q must follow each other", name)
+		}
+	}
+}
+
+// estimateMinutes estimates how long a routine takes from its reps,
+// durations and rests, plus a fixed time for moving between exercises,
+// rounded up to whole minutes.
+func estimateMinutes(routine *models.Routine) int {
+	seconds := 0
+	for _, exercise := range routine.Exercises {
+		seconds += exerciseChangeSeconds
+		for _, set := range exercise.Sets {
+			seconds += set.Reps*secondsPerRep + set.Duration + set.Rest
+			for _, drop := range set.Drops {
+				seconds += drop.Reps * secondsPerRep
+			}
+		}
+	}
+	return (seconds + 59) / 60
+}
+
+// renumberRoutine sorts the exercises of a routine by order and numbers
+// them 1..n. Ties keep their request order and exercises without an order
+// go last.
+func renumberRoutine(routine *models.Routine) {
+	key := func(order int) int {
+		if order < 1 {
+			return math.MaxInt
+		}
+		return order
+	}
+	sort.SliceStable(routine.Exercises, func(i, j int) bool {
+		return key(routine.Exercises[i].Order) < key(routine.Exercises[j].Order)
+	})
+	for i := range routine.Exercises {
+		routine.Exercises[i].Order = i + 1
+	}
+}
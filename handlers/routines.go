@@ -7,36 +7,85 @@ import (
 
 	"gym-api/m/models"
 
+	"github.com/casbin/casbin/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type RoutineHandler struct {
-	DB *mongo.Client
+	DB       *mongo.Client
+	Enforcer *casbin.Enforcer
+}
+
+// routineFilter restricts routine queries to the caller's own routines.
+// Admins are not restricted.
+func (h *RoutineHandler) routineFilter(c *gin.Context) (bson.M, bool) {
+	return ownedFilter(c, h.Enforcer)
 }
 
 func (h *RoutineHandler) GetAll(c *gin.Context) {
+	query, err := parseListQuery(c, models.Routine{}, "name", "created_at", "updated_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expand, err := expandExercises(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	collection := h.DB.Database("gym-app").Collection("routines")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
 		return
 	}
-	defer cursor.Close(ctx)
+	filter, ok := h.routineFilter(c)
+	if !ok {
+		return
+	}
+	// Admins can list the routines of one user
+	if userID := c.Query("user_id"); userID != "" {
+		if !isAdmin(c, h.Enforcer) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can list the routines of other users"})
+			return
+		}
+		objectID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			return
+		}
+		filter["user_id"] = objectID
+	}
 
 	var routines []models.Routine
-	if err := cursor.All(ctx, &routines); err != nil {
+	if err := findPage(ctx, c, collection, filter, query, &routines); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	displayRoutines(routines, units)
+
+	var results interface{} = routines
+	if expand {
+		if results, err = h.expand(ctx, c, routines); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	c.JSON(http.StatusOK, routines)
+	response, err := query.project(results)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *RoutineHandler) GetByID(c *gin.Context) {
@@ -51,8 +100,21 @@ func (h *RoutineHandler) GetByID(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+	// Templates the caller can see are readable next to their own routines
+	filter := h.readFilter(c)
+	filter["_id"] = objectID
+	expand, err := expandExercises(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var routine models.Routine
-	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&routine)
+	err = collection.FindOne(ctx, filter).Decode(&routine)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
@@ -61,10 +123,30 @@ func (h *RoutineHandler) GetByID(c *gin.Context) {
 		}
 		return
 	}
+	routine.Exercises = displayWeights(routine.Exercises, units, false)
 
+	if expand {
+		expanded, err := h.expand(ctx, c, []models.Routine{routine})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, expanded[0])
+		return
+	}
 	c.JSON(http.StatusOK, routine)
 }
 
+// expand embeds the exercise documents in routines, localized for the
+// caller.
+func (h *RoutineHandler) expand(ctx context.Context, c *gin.Context, routines []models.Routine) ([]expandedRoutine, error) {
+	locale, err := requestLocale(c)
+	if err != nil {
+		locale = models.DefaultLocale
+	}
+	return expandRoutines(ctx, h.DB, routines, locale)
+}
+
 func (h *RoutineHandler) CreateRoutine(c *gin.Context) {
 	var routine models.Routine
 	if err := c.ShouldBindJSON(&routine); err != nil {
@@ -76,23 +158,31 @@ func (h *RoutineHandler) CreateRoutine(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// add user_id from context to routine
-	if userID, exists := c.Get("user_id"); exists {
-		userIDStr, ok := userID.(string)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID in context is not a string"})
-			return
-		}
-		userObjID, err := primitive.ObjectIDFromHex(userIDStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
-			return
-		}
-		routine.UserID = userObjID
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
+	// Routines are owned by the user who creates them
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
 		return
 	}
+	routine.UserID = userID
+	routine.SourceTemplateID = nil
+	h.insertRoutine(ctx, c, collection, routine, units)
+}
+
+// insertRoutine checks a new routine with its weights in units, stores it
+// and writes it as the response.
+func (h *RoutineHandler) insertRoutine(ctx context.Context, c *gin.Context, collection *mongo.Collection, routine models.Routine, units weightUnits) {
+	if !checkRoutine(c, &routine, units.Unit) || !checkRoutineExercises(ctx, c, h.DB, routine) ||
+		!h.checkRoutineTemplate(ctx, c, nil, routine) {
+		return
+	}
+	routine.Exercises = normalizeWeights(routine.Exercises, units)
+	routine.CreatedAt = time.Now()
+	routine.UpdatedAt = routine.CreatedAt
 	result, err := collection.InsertOne(ctx, routine)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -100,6 +190,7 @@ func (h *RoutineHandler) CreateRoutine(c *gin.Context) {
 	}
 
 	routine.ID = result.InsertedID.(primitive.ObjectID)
+	routine.Exercises = displayWeights(routine.Exercises, units, false)
 	c.JSON(http.StatusOK, routine)
 }
 
@@ -115,7 +206,13 @@ func (h *RoutineHandler) DeleteRoutine(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	filter, ok := h.routineFilter(c)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+
+	result, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -146,25 +243,48 @@ func (h *RoutineHandler) UpdateRoutine(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// add user_id from context to routine
-	if userID, exists := c.Get("user_id"); exists {
-		userIDStr, ok := userID.(string)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID in context is not a string"})
-			return
-		}
-		userObjID, err := primitive.ObjectIDFromHex(userIDStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
-			return
+	filter, ok := h.routineFilter(c)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+
+	// The routine keeps its owner, also when an admin updates it
+	var existing models.Routine
+	err = collection.FindOne(ctx, filter).Decode(&existing)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
-		routine.UserID = userObjID
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in context"})
 		return
 	}
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+	routine.UserID = existing.UserID
+	routine.SourceTemplateID = existing.SourceTemplateID
+
+	if !checkRoutine(c, &routine, units.Unit) || !checkRoutineExercises(ctx, c, h.DB, routine) ||
+		!h.checkRoutineTemplate(ctx, c, existing.Template, routine) {
+		return
+	}
+	routine.Exercises = normalizeWeights(routine.Exercises, units)
+	routine.UpdatedAt = time.Now()
+	fields, err := replacementFields(routine, "created_at")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := bson.M{"$set": fields}
+	if routine.Template == nil {
+		update["$unset"] = bson.M{"template": ""}
+	}
 
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": routine})
+	result, err := collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -176,3 +296,93 @@ func (h *RoutineHandler) UpdateRoutine(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Routine updated"})
 }
+
+// PatchRoutine applies a JSON Merge Patch or JSON Patch document to a
+// routine and only writes the fields that changed. The owner and creation
+// time cannot be patched.
+func (h *RoutineHandler) PatchRoutine(c *gin.Context) {
+	id := c.Param("id")
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("routines")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := h.routineFilter(c)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+
+	var original models.Routine
+	err = collection.FindOne(ctx, filter).Decode(&original)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	// The patch applies to the weights as they were entered, not to the
+	// stored kilograms
+	entered := original
+	entered.Exercises = entryWeights(original.Exercises)
+	var routine models.Routine
+	if err := patchDocument(c, entered, &routine); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	routine.ID = original.ID
+	routine.UserID = original.UserID
+	routine.SourceTemplateID = original.SourceTemplateID
+	routine.CreatedAt = original.CreatedAt
+	routine.UpdatedAt = original.UpdatedAt
+	if err := binding.Validator.ValidateStruct(&routine); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkRoutine(c, &routine, units.Unit) || !checkRoutineExercises(ctx, c, h.DB, routine) ||
+		!h.checkRoutineTemplate(ctx, c, original.Template, routine) {
+		return
+	}
+	routine.Exercises = normalizeWeights(routine.Exercises, units)
+
+	update, err := changedFields(original, routine)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(update) > 0 {
+		routine.UpdatedAt = time.Now()
+		set, _ := update["$set"].(bson.M)
+		if set == nil {
+			set = bson.M{}
+			update["$set"] = set
+		}
+		set["updated_at"] = routine.UpdatedAt
+
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+			return
+		}
+	}
+
+	routine.Exercises = displayWeights(routine.Exercises, units, false)
+	c.JSON(http.StatusOK, routine)
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultScheduleDays is the range of a schedule query without to.
+const defaultScheduleDays = 7
+
+type ScheduleHandler struct {
+	DB       *mongo.Client
+	Enforcer *casbin.Enforcer
+}
+
+// scheduledSession is one session of a schedule entry. Start is only set
+// for entries with a time. Missing is set when the routine no longer
+// exists.
+type scheduledSession struct {
+	EntryID          primitive.ObjectID `json:"entry_id"`
+	RoutineID        primitive.ObjectID `json:"routine_id"`
+	RoutineName      string             `json:"routine_name,omitempty"`
+	Date             string             `json:"date"`
+	Start            *time.Time         `json:"start,omitempty"`
+	EstimatedMinutes int                `json:"estimated_minutes,omitempty"`
+	Missing          bool               `json:"missing,omitempty"`
+}
+
+// userSchedule loads the schedule entries of a user and the routines they
+// use.
+func userSchedule(ctx context.Context, client *mongo.Client, userID primitive.ObjectID) ([]models.ScheduleEntry, map[primitive.ObjectID]models.Routine, error) {
+	database := client.Database("gym-app")
+	cursor, err := database.Collection("schedule").Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+	var entries []models.ScheduleEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, nil, err
+	}
+
+	routines := make(map[primitive.ObjectID]models.Routine)
+	if len(entries) == 0 {
+		return entries, routines, nil
+	}
+	ids := make([]primitive.ObjectID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.RoutineID
+	}
+	cursor, err = database.Collection("routines").Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+	var found []models.Routine
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, nil, err
+	}
+	for _, routine := range found {
+		routines[routine.ID] = routine
+	}
+	return entries, routines, nil
+}
+
+// GetSchedule lists the sessions of the caller between the dates from and
+// to, both included. from defaults to today and to to a week later.
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(dateLayout, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date such as 2006-01-02"})
+			return
+		}
+	}
+	to := from.AddDate(0, 0, defaultScheduleDays-1)
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(dateLayout, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date such as 2006-01-02"})
+			return
+		}
+	}
+	if to.Before(from) || to.Sub(from) >= maxScheduleDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("to must be after from and at most %d days later", maxScheduleDays-1)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entries, routines, err := userSchedule(ctx, h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessions := []scheduledSession{}
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		for _, entry := range entries {
+			if !occursOn(entry, date) {
+				continue
+			}
+			session := scheduledSession{EntryID: entry.ID, RoutineID: entry.RoutineID, Date: date.Format(dateLayout)}
+			if routine, ok := routines[entry.RoutineID]; ok {
+				session.RoutineName = routine.Name
+				session.EstimatedMinutes = routine.EstimatedMinutes
+			} else {
+				session.Missing = true
+			}
+			if entry.Time != "" {
+				start := startTime(entry, date)
+				session.Start = &start
+			}
+			sessions = append(sessions, session)
+		}
+	}
+	// Sessions of a day are ordered by start time, all-day sessions first
+	sort.SliceStable(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Start == nil || b.Start == nil {
+			return a.Start == nil && b.Start != nil
+		}
+		return a.Start.Before(*b.Start)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"from": from.Format(dateLayout), "to": to.Format(dateLayout), "sessions": sessions})
+}
+
+func (h *ScheduleHandler) GetEntries(c *gin.Context) {
+	query, err := parseListQuery(c, models.ScheduleEntry{}, "created_at", "updated_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("schedule")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+
+	var entries []models.ScheduleEntry
+	if err := findPage(ctx, c, collection, filter, query, &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := query.project(entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// checkScheduledRoutine writes an error response and returns false when
+// the routine of an entry is not a routine of the entry's user.
+func checkScheduledRoutine(ctx context.Context, c *gin.Context, client *mongo.Client, entry models.ScheduleEntry) bool {
+	collection := client.Database("gym-app").Collection("routines")
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": entry.RoutineID, "user_id": entry.UserID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Routine not found", "routine_id": entry.RoutineID})
+		return false
+	}
+	return true
+}
+
+func (h *ScheduleHandler) CreateEntry(c *gin.Context) {
+	var entry models.ScheduleEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("schedule")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Entries are owned by the user who creates them
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	entry.UserID = userID
+	if !checkScheduleEntry(c, &entry) || !checkScheduledRoutine(ctx, c, h.DB, entry) {
+		return
+	}
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = entry.CreatedAt
+	result, err := collection.InsertOne(ctx, entry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	c.JSON(http.StatusOK, entry)
+}
+
+func (h *ScheduleHandler) UpdateEntry(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var entry models.ScheduleEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("schedule")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+
+	// The entry keeps its owner, also when an admin updates it
+	var existing models.ScheduleEntry
+	err = collection.FindOne(ctx, filter).Decode(&existing)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Schedule entry not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	entry.ID = existing.ID
+	entry.UserID = existing.UserID
+	entry.CreatedAt = existing.CreatedAt
+	if !checkScheduleEntry(c, &entry) || !checkScheduledRoutine(ctx, c, h.DB, entry) {
+		return
+	}
+	entry.UpdatedAt = time.Now()
+
+	// A replacement, so that switching between a date and weekdays drops
+	// the fields of the other kind
+	result, err := collection.ReplaceOne(ctx, filter, entry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+func (h *ScheduleHandler) DeleteEntry(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("schedule")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule entry deleted"})
+}
+
+// hashCalendarToken returns the stored form of a calendar feed token.
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateFeed creates a new calendar feed URL for the caller. The token in
+// the URL is only shown once; creating a new feed invalidates the old URL.
+func (h *ScheduleHandler) CreateFeed(c *gin.Context) {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	collection := h.DB.Database("gym-app").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"calendar_token_hash": hashCalendarToken(token)}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	c.JSON(http.StatusOK, gin.H{"url": fmt.Sprintf("%s://%s/calendar/%s.ics", scheme, c.Request.Host, token)})
+}
+
+// DeleteFeed turns off the calendar feed of the caller.
+func (h *ScheduleHandler) DeleteFeed(c *gin.Context) {
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$unset": bson.M{"calendar_token_hash": ""}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed deleted"})
+}
+
+// Feed serves the iCalendar feed of the user whose token is in the URL,
+// for calendar apps that cannot send credentials. It is a public route.
+func (h *ScheduleHandler) Feed(c *gin.Context) {
+	token, ok := strings.CutSuffix(c.Param("file"), ".ics")
+	if !ok || token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	collection := h.DB.Database("gym-app").Collection("users")
+	err := collection.FindOne(ctx, bson.M{"calendar_token_hash": hashCalendarToken(token)}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	entries, routines, err := userSchedule(ctx, h.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=900")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(writeCalendar(entries, routines, time.Now())))
+}
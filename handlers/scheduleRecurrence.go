@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	// Embedded so timezones work on hosts without a zoneinfo database
+	_ "time/tzdata"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Date and time layouts of schedule entries.
+const (
+	dateLayout = "2006-01-02"
+	timeLayout = "15:04"
+)
+
+// maxScheduleDays caps the range of a schedule query.
+const maxScheduleDays = 366
+
+// checkScheduleEntry validates a schedule entry and writes an error
+// response listing every invalid field when it fails.
+func checkScheduleEntry(c *gin.Context, entry *models.ScheduleEntry) bool {
+	errs := validateScheduleEntry(entry)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Schedule entry is invalid", "fields": errs})
+		return false
+	}
+	return true
+}
+
+// validateScheduleEntry checks that an entry is either a single date or a
+// weekly recurrence and that its dates, time and timezone parse.
+func validateScheduleEntry(entry *models.ScheduleEntry) []fieldError {
+	var errs []fieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, fieldError{Field: field, Error: fmt.Sprintf(format, args...)})
+	}
+	checkDate := func(field, value string) {
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			add(field, "must be a date such as 2006-01-02")
+		}
+	}
+
+	switch {
+	case entry.Date != "" && len(entry.Weekdays) > 0:
+		add("date", "cannot be combined with weekdays")
+	case entry.Date != "":
+		checkDate("date", entry.Date)
+		if entry.StartDate != "" || entry.EndDate != "" {
+			add("date", "cannot be combined with start_date or end_date")
+		}
+	case len(entry.Weekdays) > 0:
+		seen := make(map[int]bool)
+		for i, day := range entry.Weekdays {
+			if day < 1 || day > daysPerWeek {
+				add(fmt.Sprintf("weekdays[%d]", i), "must be between 1 and %d", daysPerWeek)
+			} else if seen[day] {
+				add(fmt.Sprintf("weekdays[%d]", i), "is listed twice")
+			}
+			seen[day] = true
+		}
+		if entry.StartDate == "" {
+			add("start_date", "is required with weekdays")
+		} else {
+			checkDate("start_date", entry.StartDate)
+		}
+		if entry.EndDate != "" {
+			checkDate("end_date", entry.EndDate)
+			if entry.StartDate != "" && entry.EndDate < entry.StartDate {
+				add("end_date", "must not be before start_date")
+			}
+		}
+	default:
+		add("date", "either date or weekdays is required")
+	}
+
+	if entry.Time != "" {
+		if _, err := time.Parse(timeLayout, entry.Time); err != nil {
+			add("time", "must be a time such as 18:30")
+		}
+	}
+	if entry.Timezone == "" {
+		entry.Timezone = "UTC"
+	} else if _, err := time.LoadLocation(entry.Timezone); err != nil {
+		add("timezone", "must be an IANA timezone such as Europe/Madrid")
+	}
+	return errs
+}
+
+// isoWeekday returns the weekday of t with Monday as 1 and Sunday as 7.
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+// occursOn reports whether a valid schedule entry has a session on date.
+func occursOn(entry models.ScheduleEntry, date time.Time) bool {
+	day := date.Format(dateLayout)
+	if entry.Date != "" {
+		return entry.Date == day
+	}
+	if day < entry.StartDate || (entry.EndDate != "" && day > entry.EndDate) {
+		return false
+	}
+	weekday := isoWeekday(date)
+	for _, d := range entry.Weekdays {
+		if d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// firstOccurrence returns the first date a valid schedule entry has a
+// session on, and false when it has none.
+func firstOccurrence(entry models.ScheduleEntry) (time.Time, bool) {
+	if entry.Date != "" {
+		date, err := time.Parse(dateLayout, entry.Date)
+		return date, err == nil
+	}
+	start, err := time.Parse(dateLayout, entry.StartDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for date := start; date.Before(start.AddDate(0, 0, daysPerWeek)); date = date.AddDate(0, 0, 1) {
+		if occursOn(entry, date) {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// startTime returns when a session on date starts, in the timezone of the
+// entry. Sessions of entries without a time start at midnight.
+func startTime(entry models.ScheduleEntry, date time.Time) time.Time {
+	location, err := time.LoadLocation(entry.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	hour, minute := 0, 0
+	if clock, err := time.Parse(timeLayout, entry.Time); err == nil {
+		hour, minute = clock.Hour(), clock.Minute()
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, location)
+}
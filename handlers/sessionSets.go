@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxSessionNotesLength caps the notes of a finished session.
+const maxSessionNotesLength = 2000
+
+// loggedSet is the request body of a performed set. Weights without a unit
+// are in the request unit. Completed defaults to true.
+type loggedSet struct {
+	Reps      int     `json:"reps"`
+	Weight    float64 `json:"weight"`
+	Unit      string  `json:"unit"`
+	Duration  int     `json:"duration"`
+	Distance  float64 `json:"distance"`
+	RPE       float64 `json:"rpe"`
+	RIR       *int    `json:"rir"`
+	Completed *bool   `json:"completed"`
+}
+
+// validateLoggedSet checks the ranges of a performed set with the same
+// limits as routine sets. A weight without a unit is in unit.
+func validateLoggedSet(set *loggedSet, unit string) []fieldError {
+	var errs []fieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, fieldError{Field: field, Error: fmt.Sprintf(format, args...)})
+	}
+
+	if set.Reps < 0 || set.Reps > maxReps {
+		add("reps", "must be between 0 and %d", maxReps)
+	}
+	if set.Unit != "" {
+		value, err := enumValue("unit", set.Unit, models.WeightUnits)
+		if err != nil {
+			add("unit", "must be one of %s", strings.Join(models.WeightUnits, ", "))
+		} else {
+			unit = value
+		}
+		set.Unit = value
+	}
+	if limit := weightLimit(unit); set.Weight < 0 || set.Weight > limit {
+		add("weight", "must be between 0 and %g %s", limit, unit)
+	}
+	if set.Duration < 0 || set.Duration > maxSetDuration {
+		add("duration", "must be between 0 and %d seconds", maxSetDuration)
+	}
+	if set.Distance < 0 || set.Distance > maxSetDistance {
+		add("distance", "must be between 0 and %g meters", maxSetDistance)
+	}
+	if set.RPE != 0 && (set.RPE < 1 || set.RPE > 10 || math.Mod(set.RPE*2, 1) != 0) {
+		add("rpe", "must be between 1 and 10 in steps of 0.5")
+	}
+	if set.RIR != nil {
+		if *set.RIR < 0 || *set.RIR > maxRIR {
+			add("rir", "must be between 0 and %d", maxRIR)
+		} else if set.RPE != 0 {
+			add("rir", "cannot be combined with rpe")
+		}
+	}
+	return errs
+}
+
+// bindLoggedSet reads a performed set from the request body and applies it
+// to set, with the weight converted to kilograms. It writes an error
+// response and returns false when the body is invalid.
+func bindLoggedSet(c *gin.Context, units weightUnits, set *models.SessionSet) bool {
+	var body loggedSet
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if errs := validateLoggedSet(&body, units.Unit); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set is invalid", "fields": errs})
+		return false
+	}
+
+	if body.Unit == "" {
+		body.Unit = units.Unit
+	}
+	set.Reps = body.Reps
+	set.Weight = models.ToKg(body.Weight, body.Unit)
+	set.Unit = body.Unit
+	set.Duration = body.Duration
+	set.Distance = body.Distance
+	set.RPE = body.RPE
+	set.RIR = body.RIR
+	set.Completed = body.Completed == nil || *body.Completed
+	set.CompletedAt = nil
+	if set.Completed {
+		now := time.Now()
+		set.CompletedAt = &now
+	}
+	return true
+}
+
+// indexParam reads a 0-based index path parameter below length. It writes
+// an error response and returns false when the index is out of range.
+func indexParam(c *gin.Context, name string, length int) (int, bool) {
+	index, err := strconv.Atoi(c.Param(name))
+	if err != nil || index < 0 || index >= length {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No %s at index %s", name, c.Param(name))})
+		return 0, false
+	}
+	return index, true
+}
+
+// LogSet records how a set of a session exercise was performed. Logging a
+// set of a skipped exercise un-skips it.
+func (h *SessionHandler) LogSet(c *gin.Context) {
+	h.modifySession(c, func(ctx context.Context, session *models.WorkoutSession, units weightUnits) bool {
+		i, ok := indexParam(c, "exercise", len(session.Exercises))
+		if !ok {
+			return false
+		}
+		exercise := &session.Exercises[i]
+		j, ok := indexParam(c, "set", len(exercise.Sets))
+		if !ok {
+			return false
+		}
+		if !bindLoggedSet(c, units, &exercise.Sets[j]) {
+			return false
+		}
+		exercise.Skipped = false
+		return true
+	})
+}
+
+// AddSet appends a performed set the routine did not plan to a session
+// exercise.
+func (h *SessionHandler) AddSet(c *gin.Context) {
+	h.modifySession(c, func(ctx context.Context, session *models.WorkoutSession, units weightUnits) bool {
+		i, ok := indexParam(c, "exercise", len(session.Exercises))
+		if !ok {
+			return false
+		}
+		exercise := &session.Exercises[i]
+		if len(exercise.Sets) >= maxSetsPerExercise {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("An exercise can have at most %d sets", maxSetsPerExercise)})
+			return false
+		}
+		var set models.SessionSet
+		if !bindLoggedSet(c, units, &set) {
+			return false
+		}
+		exercise.Sets = append(exercise.Sets, set)
+		exercise.Skipped = false
+		return true
+	})
+}
+
+// AddExercise appends an exercise the routine did not plan to a session.
+func (h *SessionHandler) AddExercise(c *gin.Context) {
+	h.modifySession(c, func(ctx context.Context, session *models.WorkoutSession, units weightUnits) bool {
+		var body struct {
+			ExerciseID primitive.ObjectID `json:"exercise_id" binding:"required"`
+			Group      string             `json:"group"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		if len(body.Group) > maxGroupLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "group is too long"})
+			return false
+		}
+		if len(session.Exercises) >= maxRoutineExercises {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A session can have at most %d exercises", maxRoutineExercises)})
+			return false
+		}
+
+		missing, err := missingExercises(ctx, h.DB, session.UserID, []models.RoutineExercise{{ExerciseID: body.ExerciseID}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Exercise does not exist"})
+			return false
+		}
+
+		order := 1
+		for _, exercise := range session.Exercises {
+			order = max(order, exercise.Order+1)
+		}
+		session.Exercises = append(session.Exercises, models.SessionExercise{
+			ExerciseID: body.ExerciseID,
+			Order:      order,
+			Group:      body.Group,
+			Sets:       []models.SessionSet{},
+		})
+		return true
+	})
+}
+
+// SkipExercise marks a session exercise as skipped.
+func (h *SessionHandler) SkipExercise(c *gin.Context) {
+	h.modifySession(c, func(ctx context.Context, session *models.WorkoutSession, units weightUnits) bool {
+		i, ok := indexParam(c, "exercise", len(session.Exercises))
+		if !ok {
+			return false
+		}
+		session.Exercises[i].Skipped = true
+		return true
+	})
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"gym-api/m/models"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultSessionName names sessions started without a routine or name.
+const defaultSessionName = "Workout"
+
+type SessionHandler struct {
+	DB       *mongo.Client
+	Enforcer *casbin.Enforcer
+}
+
+// displaySession converts the weights of a session to the request unit.
+func displaySession(session *models.WorkoutSession, units weightUnits) {
+	exercises := make([]models.SessionExercise, len(session.Exercises))
+	for i, exercise := range session.Exercises {
+		sets := make([]models.SessionSet, len(exercise.Sets))
+		for j, set := range exercise.Sets {
+			if set.Planned != nil {
+				planned := units.displaySet(*set.Planned, false)
+				set.Planned = &planned
+			}
+			set.Weight = units.convertWeight(set.Weight, false)
+			set.Unit = units.Unit
+			sets[j] = set
+		}
+		exercise.Sets = sets
+		exercises[i] = exercise
+	}
+	session.Exercises = exercises
+}
+
+// GetAll lists the caller's sessions. from and to filter on the day the
+// session started, both included, and status on whether it is finished.
+func (h *SessionHandler) GetAll(c *gin.Context) {
+	query, err := parseListQuery(c, models.WorkoutSession{}, "started_at", "finished_at", "duration")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+	started := bson.M{}
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse(dateLayout, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date such as 2006-01-02"})
+			return
+		}
+		started["$gte"] = date
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse(dateLayout, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date such as 2006-01-02"})
+			return
+		}
+		started["$lt"] = date.AddDate(0, 0, 1)
+	}
+	if len(started) > 0 {
+		filter["started_at"] = started
+	}
+	if status := c.Query("status"); status != "" {
+		value, err := enumValue("status", status, []string{models.SessionInProgress, models.SessionFinished})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter["status"] = value
+	}
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	var sessions []models.WorkoutSession
+	if err := findPage(ctx, c, collection, filter, query, &sessions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range sessions {
+		displaySession(&sessions[i], units)
+	}
+
+	response, err := query.project(sessions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *SessionHandler) GetByID(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	var session models.WorkoutSession
+	err = collection.FindOne(ctx, filter).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	displaySession(&session, units)
+	c.JSON(http.StatusOK, session)
+}
+
+// StartSession starts a session for the caller. With a routine_id the
+// session takes the routine's name and exercises, with its sets as the
+// planned sets.
+func (h *SessionHandler) StartSession(c *gin.Context) {
+	var body struct {
+		RoutineID *primitive.ObjectID `json:"routine_id"`
+		Name      string              `json:"name"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if len(body.Name) > maxRoutineNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is too long"})
+		return
+	}
+
+	database := h.DB.Database("gym-app")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Sessions are owned by the user who starts them
+	userID, err := userIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	session := models.WorkoutSession{
+		UserID:    userID,
+		Name:      body.Name,
+		Status:    models.SessionInProgress,
+		Exercises: []models.SessionExercise{},
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	if body.RoutineID != nil {
+		var routine models.Routine
+		err := database.Collection("routines").FindOne(ctx, bson.M{"_id": *body.RoutineID, "user_id": userID}).Decode(&routine)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Routine not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		session.RoutineID = &routine.ID
+		if session.Name == "" {
+			session.Name = routine.Name
+		}
+		for _, entry := range mapSets(routine.Exercises, func(set models.Set) models.Set { return set }) {
+			exercise := models.SessionExercise{ExerciseID: entry.ExerciseID, Order: entry.Order, Group: entry.Group, Sets: []models.SessionSet{}}
+			for _, set := range entry.Sets {
+				planned := set
+				exercise.Sets = append(exercise.Sets, models.SessionSet{Planned: &planned})
+			}
+			session.Exercises = append(session.Exercises, exercise)
+		}
+		sort.SliceStable(session.Exercises, func(i, j int) bool {
+			return session.Exercises[i].Order < session.Exercises[j].Order
+		})
+	}
+	if session.Name == "" {
+		session.Name = defaultSessionName
+	}
+
+	result, err := database.Collection("sessions").InsertOne(ctx, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	session.ID = result.InsertedID.(primitive.ObjectID)
+	displaySession(&session, units)
+	c.JSON(http.StatusOK, session)
+}
+
+// FinishSession ends a session with optional notes and records how long
+// it took.
+func (h *SessionHandler) FinishSession(c *gin.Context) {
+	var body struct {
+		Notes string `json:"notes"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if len(body.Notes) > maxSessionNotesLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "notes is too long"})
+		return
+	}
+
+	h.modifySession(c, func(ctx context.Context, session *models.WorkoutSession, units weightUnits) bool {
+		now := time.Now()
+		session.Status = models.SessionFinished
+		session.FinishedAt = &now
+		session.Duration = int(now.Sub(session.StartedAt).Seconds())
+		session.Notes = body.Notes
+		return true
+	})
+}
+
+func (h *SessionHandler) DeleteSession(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session deleted"})
+}
+
+// modifySession loads the session named by the id path parameter, lets
+// change modify it and stores it. Only sessions in progress can be
+// changed. change writes an error response and returns false when the
+// change is invalid. A session changed by another request in the meantime
+// is not overwritten.
+func (h *SessionHandler) modifySession(c *gin.Context, change func(ctx context.Context, session *models.WorkoutSession, units weightUnits) bool) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	collection := h.DB.Database("gym-app").Collection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, ok := ownedFilter(c, h.Enforcer)
+	if !ok {
+		return
+	}
+	filter["_id"] = objectID
+	units, ok := requestUnits(ctx, c, h.DB)
+	if !ok {
+		return
+	}
+
+	var session models.WorkoutSession
+	err = collection.FindOne(ctx, filter).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if session.Status == models.SessionFinished {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is finished"})
+		return
+	}
+
+	if !change(ctx, &session, units) {
+		return
+	}
+	filter["updated_at"] = session.UpdatedAt
+	session.UpdatedAt = time.Now()
+	result, err := collection.ReplaceOne(ctx, filter, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session was changed by another request, reload it and try again"})
+		return
+	}
+
+	displaySession(&session, units)
+	c.JSON(http.StatusOK, session)
+}
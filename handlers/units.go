@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+
+	"gym-api/m/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// weightUnits is the unit weights are read and written in for a request,
+// with the plate increment computed weights are rounded to.
+type weightUnits struct {
+	Unit      string
+	Increment float64
+}
+
+// requestUnits returns the weight unit of the request: the units query
+// parameter, else the caller's preferred unit, else kilograms. It writes an
+// error response and returns false when units is not a supported unit.
+func requestUnits(ctx context.Context, c *gin.Context, client *mongo.Client) (weightUnits, bool) {
+	units := weightUnits{Unit: models.UnitKg}
+	if userID, err := userIDFromContext(c); err == nil {
+		var user models.User
+		opts := options.FindOne().SetProjection(bson.M{"weight_unit": 1, "plate_increment": 1})
+		err := client.Database("gym-app").Collection("users").FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&user)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return units, false
+		}
+		if user.WeightUnit != "" {
+			units = weightUnits{Unit: user.WeightUnit, Increment: user.PlateIncrement}
+		}
+	}
+
+	if unit := c.Query("units"); unit != "" {
+		value, err := enumValue("units", unit, models.WeightUnits)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return units, false
+		}
+		// The preferred increment only applies to the preferred unit
+		if value != units.Unit {
+			units = weightUnits{Unit: value}
+		}
+	}
+	if units.Increment <= 0 {
+		units.Increment = models.DefaultPlateIncrements[units.Unit]
+	}
+	return units, true
+}
+
+// round rounds a weight in the request unit to the plate increment.
+func (u weightUnits) round(weight float64) float64 {
+	return roundWeight(math.Round(weight/u.Increment) * u.Increment)
+}
+
+// roundWeight rounds away the noise of converting a weight back and forth.
+func roundWeight(weight float64) float64 {
+	return math.Round(weight*100) / 100
+}
+
+// convertWeight converts a weight stored in kilograms to the request unit.
+// With plates, for weights computed by a progression, it is rounded to the
+// plate increment; otherwise only the noise of the conversion is rounded
+// away, so that a weight sent back unchanged keeps its value. A weight is
+// never rounded down to zero.
+func (u weightUnits) convertWeight(weight float64, plates bool) float64 {
+	converted := models.FromKg(weight, u.Unit)
+	if plates {
+		if rounded := u.round(converted); rounded > 0 || weight <= 0 {
+			return rounded
+		}
+		return u.Increment
+	}
+	if rounded := roundWeight(converted); rounded > 0 || weight <= 0 {
+		return rounded
+	}
+	return 0.01
+}
+
+// weightLimit is the largest weight of a set in unit, so that the limit is
+// the same whatever unit a weight is entered in.
+func weightLimit(unit string) float64 {
+	return roundWeight(models.FromKg(maxWeight, unit))
+}
+
+// entryUnit is the unit a weight was entered in. Weights stored before
+// units existed are in kilograms.
+func entryUnit(unit string) string {
+	if unit == "" {
+		return models.UnitKg
+	}
+	return unit
+}
+
+// mapSets returns a copy of exercises with fn applied to every set.
+func mapSets(exercises []models.RoutineExercise, fn func(models.Set) models.Set) []models.RoutineExercise {
+	if exercises == nil {
+		return nil
+	}
+	mapped := make([]models.RoutineExercise, len(exercises))
+	for i, exercise := range exercises {
+		sets := make([]models.Set, len(exercise.Sets))
+		for j, set := range exercise.Sets {
+			set.Drops = append([]models.DropStep(nil), set.Drops...)
+			sets[j] = fn(set)
+		}
+		exercise.Sets = sets
+		mapped[i] = exercise
+	}
+	return mapped
+}
+
+// normalizeWeights converts the weights of a request body to kilograms.
+// Sets without a unit are in the request unit.
+func normalizeWeights(exercises []models.RoutineExercise, units weightUnits) []models.RoutineExercise {
+	return mapSets(exercises, func(set models.Set) models.Set {
+		if set.Unit == "" {
+			set.Unit = units.Unit
+		}
+		set.Weight = models.ToKg(set.Weight, set.Unit)
+		for i := range set.Drops {
+			set.Drops[i].Weight = models.ToKg(set.Drops[i].Weight, set.Unit)
+		}
+		return set
+	})
+}
+
+// displayWeights converts stored weights to the request unit. With plates
+// every weight is rounded to the plate increment, e.g. for weights
+// computed by a progression.
+func displayWeights(exercises []models.RoutineExercise, units weightUnits, plates bool) []models.RoutineExercise {
+	return mapSets(exercises, func(set models.Set) models.Set {
+		return units.displaySet(set, plates)
+	})
+}
+
+// displaySet converts the stored weights of a set to the request unit.
+func (u weightUnits) displaySet(set models.Set, plates bool) models.Set {
+	set.Weight = u.convertWeight(set.Weight, plates)
+	drops := make([]models.DropStep, len(set.Drops))
+	for i, drop := range set.Drops {
+		drop.Weight = u.convertWeight(drop.Weight, plates)
+		drops[i] = drop
+	}
+	if set.Drops != nil {
+		set.Drops = drops
+	}
+	set.Unit = u.Unit
+	return set
+}
+
+// entryWeights converts stored weights back to the unit each was entered
+// in, so that a patch applies to the values the client wrote.
+func entryWeights(exercises []models.RoutineExercise) []models.RoutineExercise {
+	return mapSets(exercises, func(set models.Set) models.Set {
+		set.Unit = entryUnit(set.Unit)
+		set.Weight = roundWeight(models.FromKg(set.Weight, set.Unit))
+		for i := range set.Drops {
+			set.Drops[i].Weight = roundWeight(models.FromKg(set.Drops[i].Weight, set.Unit))
+		}
+		return set
+	})
+}
+
+// displayRoutines converts the weights of routines to the request unit.
+func displayRoutines(routines []models.Routine, units weightUnits) {
+	for i := range routines {
+		routines[i].Exercises = displayWeights(routines[i].Exercises, units, false)
+	}
+}
+
+// normalizeProgressions converts the weight increments of a request body
+// to kilograms. Increments without a unit are in the request unit.
+func normalizeProgressions(progressions []models.Progression, units weightUnits) {
+	for i := range progressions {
+		if progressions[i].Unit == "" {
+			progressions[i].Unit = units.Unit
+		}
+		progressions[i].WeightIncrement = models.ToKg(progressions[i].WeightIncrement, progressions[i].Unit)
+	}
+}
+
+// displayProgressions returns a copy of progressions with the weight
+// increments in the request unit. With units nil they are shown in the
+// unit each was entered in.
+func displayProgressions(progressions []models.Progression, units *weightUnits) []models.Progression {
+	if progressions == nil {
+		return nil
+	}
+	displayed := make([]models.Progression, len(progressions))
+	for i, progression := range progressions {
+		unit := entryUnit(progression.Unit)
+		if units != nil {
+			unit = units.Unit
+		}
+		progression.WeightIncrement = roundWeight(models.FromKg(progression.WeightIncrement, unit))
+		progression.Unit = unit
+		displayed[i] = progression
+	}
+	return displayed
+}
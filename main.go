@@ -1,13 +1,16 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"os"
 
 	"gym-api/m/config"
 	"gym-api/m/db"
 	"gym-api/m/handlers"
 	"gym-api/m/middleware"
+	"gym-api/m/storage"
 
 	limit "github.com/aviddiviner/gin-limit"
 	"github.com/casbin/casbin/v2"
@@ -16,6 +19,7 @@ import (
 	limiterlib "github.com/ulule/limiter/v3"
 	mgin "github.com/ulule/limiter/v3/drivers/middleware/gin"
 	memory "github.com/ulule/limiter/v3/drivers/store/memory"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func main() {
@@ -26,6 +30,16 @@ func main() {
 	client := db.Connect(cfg.MongoURI)
 	defer db.Disconnect(client)
 
+	// Run a one-off command instead of the server, e.g. `server seed`
+	if len(os.Args) > 1 {
+		runCommand(client, os.Args[1], os.Args[2:])
+		return
+	}
+
+	if err := db.EnsureIndexes(client); err != nil {
+		log.Fatal(err)
+	}
+
 	// Initialize casbin adapter and enforcer
 	adapter, err := mongodbadapter.NewAdapter(cfg.MongoURI) // Your MongoDB URL.
 	if err != nil {
@@ -40,12 +54,23 @@ func main() {
 		log.Fatal(err)
 	}
 
+	mediaStorage, err := storage.NewLocal(cfg.MediaDir, cfg.MediaBaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Initialize handlers
-	exerciseHandler := &handlers.ExerciseHandler{DB: client}
+	exerciseHandler := &handlers.ExerciseHandler{DB: client, Enforcer: enforcer, Storage: mediaStorage}
 	apiKeyHandler := &handlers.APIKeyHandler{DB: client}
 	permissionHandler := &handlers.PermissionHandler{DB: client, Enforcer: enforcer}
 	authenticationHandler := &handlers.AuthenticationHandler{DB: client, Enforcer: enforcer}
-	routineHandler := &handlers.RoutineHandler{DB: client}
+	routineHandler := &handlers.RoutineHandler{DB: client, Enforcer: enforcer}
+	programHandler := &handlers.ProgramHandler{DB: client, Enforcer: enforcer}
+	scheduleHandler := &handlers.ScheduleHandler{DB: client, Enforcer: enforcer}
+	sessionHandler := &handlers.SessionHandler{DB: client, Enforcer: enforcer}
+	muscleHandler := &handlers.MuscleHandler{}
+	equipmentHandler := &handlers.EquipmentHandler{}
+	profileHandler := &handlers.ProfileHandler{DB: client}
 
 	// Rate limiter setup
 	rate, err := limiterlib.NewRateFromFormatted("1-S")
@@ -70,6 +95,13 @@ func main() {
 	r.POST("/login", authenticationHandler.Login)
 	r.POST("/applications/token", authenticationHandler.GenerateApplicationJWT)
 
+	// Uploaded media is public so it can be used directly in img and video tags
+	r.Static("/media", cfg.MediaDir)
+
+	// Calendar feeds are protected by the token in their URL, since calendar
+	// apps cannot send credentials
+	r.GET("/calendar/:file", scheduleHandler.Feed)
+
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "pong",
@@ -83,17 +115,71 @@ func main() {
 	protected.Use(middleware.Authorize(enforcer, nil))
 
 	protected.GET("/exercises", exerciseHandler.GetAll)
+	protected.GET("/exercises/search", exerciseHandler.Search)
+	protected.GET("/exercises/facets", exerciseHandler.Facets)
 	protected.GET("/exercises/:id", exerciseHandler.GetByID)
+	protected.GET("/exercises/:id/alternatives", exerciseHandler.Alternatives)
+	protected.GET("/exercises/:id/media", exerciseHandler.GetMedia)
+	protected.POST("/exercises/:id/media", exerciseHandler.UploadMedia)
+	protected.DELETE("/exercises/:id/media/:mediaId", exerciseHandler.DeleteMedia)
+	protected.GET("/exercises/:id/revisions", exerciseHandler.GetRevisions)
+	protected.GET("/exercises/:id/revisions/diff", exerciseHandler.DiffRevisions)
+	protected.GET("/exercises/:id/revisions/:revision", exerciseHandler.GetRevision)
+	protected.POST("/exercises/:id/revisions/:revision/revert", exerciseHandler.RevertRevision)
 	protected.POST("/exercises", exerciseHandler.Create)
+	protected.POST("/exercises\\:batch", exerciseHandler.Batch)
 	protected.PUT("/exercises/:id", exerciseHandler.Update)
+	protected.PATCH("/exercises/:id", exerciseHandler.Patch)
 	protected.DELETE("/exercises/:id", exerciseHandler.Delete)
 
+	protected.GET("/translations/exercises/missing", exerciseHandler.GetMissingTranslations)
+	protected.PUT("/translations/exercises/:id/:lang", exerciseHandler.UpsertTranslation)
+
+	protected.GET("/muscles", muscleHandler.GetAll)
+	protected.GET("/equipment", equipmentHandler.GetAll)
+
+	protected.GET("/profile/equipment", profileHandler.GetEquipment)
+	protected.PUT("/profile/equipment", profileHandler.UpdateEquipment)
+	protected.GET("/profile/units", profileHandler.GetUnits)
+	protected.PUT("/profile/units", profileHandler.UpdateUnits)
+
 	protected.GET("/routines", routineHandler.GetAll)
+	protected.GET("/routines/templates", routineHandler.GetTemplates)
 	protected.GET("/routines/:id", routineHandler.GetByID)
+	protected.GET("/routines/:id/export", routineHandler.ExportRoutine)
 	protected.POST("/routines", routineHandler.CreateRoutine)
+	protected.POST("/routines/import", routineHandler.ImportRoutine)
+	protected.POST("/routines/:id/clone", routineHandler.CloneRoutine)
 	protected.PUT("/routines/:id", routineHandler.UpdateRoutine)
+	protected.PATCH("/routines/:id", routineHandler.PatchRoutine)
 	protected.DELETE("/routines/:id", routineHandler.DeleteRoutine)
 
+	protected.GET("/programs", programHandler.GetAll)
+	protected.GET("/programs/:id", programHandler.GetByID)
+	protected.GET("/programs/:id/weeks/:week", programHandler.GetWeek)
+	protected.POST("/programs", programHandler.CreateProgram)
+	protected.PUT("/programs/:id", programHandler.UpdateProgram)
+	protected.PATCH("/programs/:id", programHandler.PatchProgram)
+	protected.DELETE("/programs/:id", programHandler.DeleteProgram)
+
+	protected.GET("/schedule", scheduleHandler.GetSchedule)
+	protected.GET("/schedule/entries", scheduleHandler.GetEntries)
+	protected.POST("/schedule/entries", scheduleHandler.CreateEntry)
+	protected.PUT("/schedule/entries/:id", scheduleHandler.UpdateEntry)
+	protected.DELETE("/schedule/entries/:id", scheduleHandler.DeleteEntry)
+	protected.POST("/schedule/feed", scheduleHandler.CreateFeed)
+	protected.DELETE("/schedule/feed", scheduleHandler.DeleteFeed)
+
+	protected.GET("/sessions", sessionHandler.GetAll)
+	protected.GET("/sessions/:id", sessionHandler.GetByID)
+	protected.POST("/sessions", sessionHandler.StartSession)
+	protected.POST("/sessions/:id/exercises", sessionHandler.AddExercise)
+	protected.POST("/sessions/:id/exercises/:exercise/skip", sessionHandler.SkipExercise)
+	protected.POST("/sessions/:id/exercises/:exercise/sets", sessionHandler.AddSet)
+	protected.PUT("/sessions/:id/exercises/:exercise/sets/:set", sessionHandler.LogSet)
+	protected.POST("/sessions/:id/finish", sessionHandler.FinishSession)
+	protected.DELETE("/sessions/:id", sessionHandler.DeleteSession)
+
 	protected.GET("/api-keys", apiKeyHandler.GetAll)
 	protected.GET("/api-keys/:account", apiKeyHandler.GetByAccount)
 	protected.GET("/api-keys/validate/:api_key", apiKeyHandler.Validate)
@@ -118,3 +204,25 @@ func main() {
 
 	r.Run() // listen and serve on 0.0.0.0:8080 by default
 }
+
+func runCommand(client *mongo.Client, name string, args []string) {
+	switch name {
+	case "seed":
+		fs := flag.NewFlagSet("seed", flag.ExitOnError)
+		file := fs.String("file", "sample.json", "path to the exercise catalog JSON file")
+		fs.Parse(args)
+
+		result, err := db.SeedExercises(client, *file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Seeded exercises from %s: %d inserted, %d updated, %d skipped",
+			*file, result.Inserted, result.Updated, result.Skipped)
+	case "migrate":
+		if err := db.Migrate(client); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown command %q", name)
+	}
+}
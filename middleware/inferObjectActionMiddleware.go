@@ -6,6 +6,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// customMethodActions lists the actions performed by custom methods such as
+// /exercises:batch. Callers allowed any of them reach the handler, which
+// checks each operation against its own action.
+var customMethodActions = map[string][]string{
+	"batch": {"create", "update", "delete"},
+}
+
 func InferObjectAction() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var action string
@@ -31,6 +38,14 @@ func InferObjectAction() gin.HandlerFunc {
 			if len(parts) > 1 {
 				object = parts[1]
 			}
+			// Custom methods name their own action, e.g. /exercises:batch
+			if name, method, found := strings.Cut(object, ":"); found {
+				object = name
+				action = method
+				if actions, ok := customMethodActions[method]; ok {
+					c.Set("inferred_actions", actions)
+				}
+			}
 		}
 
 		if object == "" {
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"gym-api/m/config"
@@ -10,7 +11,9 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var cfg = config.Load()
+// cfg is loaded on first use, so that the package can be loaded without
+// the server environment, e.g. in tests.
+var cfg = sync.OnceValue(config.Load)
 
 func JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -25,7 +28,7 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
-			return cfg.JWTKey, nil
+			return cfg().JWTKey, nil
 		})
 		if err != nil || !token.Valid {
 			fmt.Printf("invalid token")
@@ -22,9 +22,10 @@ func SecureHeadersMiddleware() gin.HandlerFunc {
 			"magnetometer=(),gyroscope=(),fullscreen=(self),payment=()"
 		c.Header("Permissions-Policy", permPolicy)
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-API-Key")
 		c.Header("Access-Control-Allow-Credentials", "true")
+		c.Header("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -0,0 +1,100 @@
+package models
+
+import "strings"
+
+type Equipment struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Keywords that name this equipment in an exercise name
+	Keywords []string `json:"-"`
+	// Implement is set for the equipment that carries the load, as opposed
+	// to accessories such as benches and bars.
+	Implement bool `json:"-"`
+}
+
+// EquipmentList is the canonical equipment registry. Bodyweight is always
+// considered available.
+var EquipmentList = []Equipment{
+	{ID: "barbell", Name: "Barbell", Keywords: []string{"barbell", "t-bar"}, Implement: true},
+	{ID: "dumbbell", Name: "Dumbbell", Keywords: []string{"dumbbell", "arnold press", "hammer curl", "concentration curl", "zottman", "lateral raise", "globet", "goblet"}, Implement: true},
+	{ID: "ez-bar", Name: "EZ Bar", Keywords: []string{"ez curl", "ez bar"}, Implement: true},
+	{ID: "trap-bar", Name: "Trap Bar", Keywords: []string{"trap bar"}, Implement: true},
+	{ID: "kettlebell", Name: "Kettlebell", Keywords: []string{"kettlebell"}, Implement: true},
+	{ID: "landmine", Name: "Landmine", Keywords: []string{"landmine", "t-bar"}, Implement: true},
+	{ID: "cable", Name: "Cable", Keywords: []string{"cable", "pulldown", "face pull", "pushdown"}, Implement: true},
+	{ID: "machine", Name: "Machine", Keywords: []string{"machine", "leg press", "leg extension", "leg curl", "pec deck", "calf raise"}, Implement: true},
+	{ID: "resistance-band", Name: "Resistance Band", Keywords: []string{"band"}, Implement: true},
+	{ID: "weight-plate", Name: "Weight Plate", Keywords: []string{"front hold", "plate"}, Implement: true},
+	{ID: "bench", Name: "Bench", Keywords: []string{"bench", "incline", "decline", "preacher", "seated dumbbell", "concentration curl", "pullover"}},
+	{ID: "pull-up-bar", Name: "Pull-up Bar", Keywords: []string{"pull up", "pull-up", "chin up", "chin-up", "inverted row"}},
+	{ID: "dip-bars", Name: "Dip Bars", Keywords: []string{"bar dips"}},
+	{ID: "bodyweight", Name: "Bodyweight", Keywords: []string{"bodyweight", "air squat", "jump", "push up", "split squat", "inverted row"}},
+}
+
+// impliedEquipment covers lifts whose name does not spell out the implement
+// because it is the usual one, e.g. "Deadlift" or "Hack Squat". They only
+// apply when the name mentions no other implement.
+var impliedEquipment = []struct {
+	keyword   string
+	equipment string
+}{
+	{"hack squat", "machine"},
+	{"skull crusher", "ez-bar"},
+	{"deadlift", "barbell"},
+	{"clean", "barbell"},
+	{"snatch", "barbell"},
+	{"bench press", "barbell"},
+	{"overhead press", "barbell"},
+	{"push press", "barbell"},
+	{"neck press", "barbell"},
+	{"row", "barbell"},
+	{"squat", "barbell"},
+	{"shrug", "barbell"},
+}
+
+// LookupEquipment resolves an equipment ID or name, ignoring case.
+func LookupEquipment(name string) (Equipment, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, equipment := range EquipmentList {
+		if equipment.ID == name || strings.ToLower(equipment.Name) == name {
+			return equipment, true
+		}
+	}
+	return Equipment{}, false
+}
+
+// InferEquipment guesses the equipment an exercise needs from its name,
+// e.g. "Incline Dumbbell Press" needs a dumbbell and a bench. Names without
+// any known keyword are taken to be bodyweight exercises.
+func InferEquipment(exerciseName string) []string {
+	name := strings.ToLower(exerciseName)
+	equipment := []string{}
+	hasImplement, bodyweight := false, false
+	for _, item := range EquipmentList {
+		for _, keyword := range item.Keywords {
+			if !strings.Contains(name, keyword) {
+				continue
+			}
+			if item.ID == "bodyweight" {
+				bodyweight = true
+			} else {
+				equipment = append(equipment, item.ID)
+				hasImplement = hasImplement || item.Implement
+			}
+			break
+		}
+	}
+
+	if !hasImplement && !bodyweight {
+		for _, implied := range impliedEquipment {
+			if strings.Contains(name, implied.keyword) {
+				equipment = append(equipment, implied.equipment)
+				break
+			}
+		}
+	}
+	if len(equipment) == 0 {
+		equipment = append(equipment, "bodyweight")
+	}
+	return equipment
+}
@@ -1,12 +1,72 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Exercise struct {
-	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Exercise         string             `bson:"Exercise" json:"Exercise" binding:"required"`
-	PrimaryMuscles   string             `bson:"Primary Muscles" json:"PrimaryMuscles" binding:"required"`
-	SecondaryMuscles string             `bson:"Secondary Muscles" json:"SecondaryMuscles"`
-	Type             string             `bson:"Type" json:"Type" binding:"required"`
-	Focus            string             `bson:"Focus" json:"Focus" binding:"required"`
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Exercise           string             `bson:"Exercise" json:"Exercise" binding:"required"`
+	PrimaryMuscleIDs   []string           `bson:"primary_muscles" json:"primary_muscles"`
+	SecondaryMuscleIDs []string           `bson:"secondary_muscles" json:"secondary_muscles"`
+	Equipment          []string           `bson:"equipment" json:"equipment"`
+	Type               string             `bson:"Type" json:"Type" binding:"required"`
+	Focus              string             `bson:"Focus" json:"Focus" binding:"required"`
+
+	// Coaching content. Instructions are the steps of the movement in
+	// order; the enum fields take the values listed below.
+	Instructions    []string `bson:"instructions,omitempty" json:"instructions,omitempty"`
+	Cues            []string `bson:"cues,omitempty" json:"cues,omitempty"`
+	Mistakes        []string `bson:"mistakes,omitempty" json:"mistakes,omitempty"`
+	Difficulty      string   `bson:"difficulty,omitempty" json:"difficulty,omitempty"`
+	MovementPattern string   `bson:"movement_pattern,omitempty" json:"movement_pattern,omitempty"`
+	Laterality      string   `bson:"laterality,omitempty" json:"laterality,omitempty"`
+	ForceType       string   `bson:"force_type,omitempty" json:"force_type,omitempty"`
+
+	// Media is managed through the media endpoints and ignored when sent
+	// with an exercise.
+	Media []Media `bson:"media,omitempty" json:"media,omitempty"`
+
+	// OwnerID is the user who created a private exercise. Exercises without
+	// an owner belong to the global catalog.
+	OwnerID *primitive.ObjectID `bson:"owner_id,omitempty" json:"owner_id,omitempty"`
+
+	// Translations of the text fields keyed by locale. The fields above
+	// hold the text in the default locale.
+	Translations map[string]ExerciseTranslation `bson:"translations,omitempty" json:"translations,omitempty"`
+
+	// Archived exercises are hidden from the catalog but still resolve for
+	// the routines that use them.
+	Archived   bool       `bson:"archived,omitempty" json:"archived,omitempty"`
+	ArchivedAt *time.Time `bson:"archived_at,omitempty" json:"archived_at,omitempty"`
+
+	// Legacy comma separated muscle names, accepted on input for older
+	// clients and converted to muscle IDs before storing.
+	PrimaryMuscles   string `bson:"-" json:"PrimaryMuscles,omitempty"`
+	SecondaryMuscles string `bson:"-" json:"SecondaryMuscles,omitempty"`
+
+	// Set on responses localized for the caller. MuscleNames maps the
+	// muscle IDs of the exercise to their name in Locale.
+	Locale      string            `bson:"-" json:"locale,omitempty"`
+	MuscleNames map[string]string `bson:"-" json:"muscle_names,omitempty"`
 }
+
+// ExerciseTranslation is the text of an exercise in one locale. Muscles
+// maps muscle IDs to their localized names.
+type ExerciseTranslation struct {
+	Name         string            `bson:"name" json:"name" binding:"required"`
+	Instructions []string          `bson:"instructions,omitempty" json:"instructions,omitempty"`
+	Cues         []string          `bson:"cues,omitempty" json:"cues,omitempty"`
+	Mistakes     []string          `bson:"mistakes,omitempty" json:"mistakes,omitempty"`
+	Muscles      map[string]string `bson:"muscles,omitempty" json:"muscles,omitempty"`
+}
+
+// Allowed values of the enum fields of an exercise.
+var (
+	Difficulties     = []string{"beginner", "intermediate", "advanced"}
+	MovementPatterns = []string{"squat", "hinge", "push", "pull", "carry"}
+	Lateralities     = []string{"bilateral", "unilateral"}
+	ForceTypes       = []string{"push", "pull", "static"}
+)
@@ -0,0 +1,22 @@
+package models
+
+import "strings"
+
+// DefaultLocale is the language of the text stored directly on exercises.
+// Other locales are stored as translations.
+const DefaultLocale = "en"
+
+// Locales lists the languages the app ships in.
+var Locales = []string{"en", "es"}
+
+// LookupLocale matches a language tag such as "es" or "es-MX" to a
+// supported locale.
+func LookupLocale(tag string) (string, bool) {
+	language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	for _, locale := range Locales {
+		if locale == language {
+			return locale, true
+		}
+	}
+	return "", false
+}
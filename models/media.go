@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Media is an image, GIF or video attached to an exercise. Key locates
+// the file in storage and URL is where clients download it.
+type Media struct {
+	ID          primitive.ObjectID `bson:"id" json:"id"`
+	Kind        string             `bson:"kind" json:"kind"`
+	ContentType string             `bson:"content_type" json:"content_type"`
+	Size        int64              `bson:"size" json:"size"`
+	Key         string             `bson:"key" json:"-"`
+	URL         string             `bson:"url" json:"url"`
+	Width       int                `bson:"width,omitempty" json:"width,omitempty"`
+	Height      int                `bson:"height,omitempty" json:"height,omitempty"`
+	Caption     string             `bson:"caption,omitempty" json:"caption,omitempty"`
+	Thumbnail   *Thumbnail         `bson:"thumbnail,omitempty" json:"thumbnail,omitempty"`
+	UploadedBy  string             `bson:"uploaded_by" json:"uploaded_by"`
+	UploadedAt  time.Time          `bson:"uploaded_at" json:"uploaded_at"`
+}
+
+// Thumbnail is a downscaled JPEG preview of an image or the first frame of
+// a GIF. Videos have no thumbnail.
+type Thumbnail struct {
+	Key    string `bson:"key" json:"-"`
+	URL    string `bson:"url" json:"url"`
+	Width  int    `bson:"width" json:"width"`
+	Height int    `bson:"height" json:"height"`
+}
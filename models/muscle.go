@@ -0,0 +1,80 @@
+package models
+
+import "strings"
+
+type Muscle struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Region  string   `json:"region"`
+	Aliases []string `json:"aliases"`
+}
+
+// Muscles is the canonical muscle registry. Exercises reference muscles by
+// ID; aliases cover the spellings found in the original catalog import.
+var Muscles = []Muscle{
+	{ID: "quads", Name: "Quads", Region: "legs", Aliases: []string{"quadriceps", "quad"}},
+	{ID: "hamstrings", Name: "Hamstrings", Region: "legs", Aliases: []string{"hamstring"}},
+	{ID: "glutes", Name: "Glutes", Region: "legs", Aliases: []string{"glute", "gluteus"}},
+	{ID: "adductors", Name: "Adductors", Region: "legs", Aliases: []string{"adductor"}},
+	{ID: "abductors", Name: "Abductors", Region: "legs", Aliases: []string{"abductor"}},
+	{ID: "calves", Name: "Calves", Region: "legs", Aliases: []string{"calf"}},
+	{ID: "lats", Name: "Lats", Region: "back", Aliases: []string{"latissimus dorsi", "lat"}},
+	{ID: "trapezius", Name: "Trapezius", Region: "back", Aliases: []string{"traps", "trap"}},
+	{ID: "lower-back", Name: "Lower Back", Region: "back", Aliases: []string{"erector spinae", "lower backs"}},
+	{ID: "chest", Name: "Chest", Region: "chest", Aliases: []string{"pecs", "pectorals"}},
+	{ID: "front-deltoid", Name: "Front Deltoid", Region: "shoulders", Aliases: []string{"front deltoids", "anterior deltoid", "anterior deltoids"}},
+	{ID: "lateral-deltoid", Name: "Lateral Deltoid", Region: "shoulders", Aliases: []string{"lateral deltoids", "side deltoid", "side deltoids"}},
+	{ID: "rear-deltoid", Name: "Rear Deltoid", Region: "shoulders", Aliases: []string{"rear deltoids", "posterior deltoid", "posterior deltoids"}},
+	{ID: "rotator-cuff", Name: "Rotator Cuff", Region: "shoulders", Aliases: []string{"rotator cuffs"}},
+	{ID: "biceps", Name: "Biceps", Region: "arms", Aliases: []string{"bicep"}},
+	{ID: "triceps", Name: "Triceps", Region: "arms", Aliases: []string{"tricep"}},
+	{ID: "forearm-flexors", Name: "Forearm Flexors", Region: "arms", Aliases: []string{"forearms flexors", "forarm flexors", "forearms", "forearm"}},
+	{ID: "abs", Name: "Abs", Region: "core", Aliases: []string{"abdominals", "core"}},
+	{ID: "obliques", Name: "Obliques", Region: "core", Aliases: []string{"oblique"}},
+}
+
+var muscleIndex = buildMuscleIndex()
+
+func buildMuscleIndex() map[string]Muscle {
+	index := make(map[string]Muscle)
+	for _, muscle := range Muscles {
+		index[muscle.ID] = muscle
+		index[strings.ToLower(muscle.Name)] = muscle
+		for _, alias := range muscle.Aliases {
+			index[alias] = muscle
+		}
+	}
+	return index
+}
+
+// LookupMuscle resolves a muscle ID, display name or alias, ignoring case
+// and surrounding whitespace.
+func LookupMuscle(name string) (Muscle, bool) {
+	key := strings.ToLower(strings.Join(strings.Fields(name), " "))
+	muscle, ok := muscleIndex[key]
+	return muscle, ok
+}
+
+// ParseMuscleList converts a legacy comma separated muscle string such as
+// "Quads, Hamstrings, Glutes" into muscle IDs. Names that cannot be resolved
+// are returned separately.
+func ParseMuscleList(list string) (ids []string, unknown []string) {
+	ids = []string{}
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		muscle, ok := LookupMuscle(name)
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		if !seen[muscle.ID] {
+			seen[muscle.ID] = true
+			ids = append(ids, muscle.ID)
+		}
+	}
+	return ids, unknown
+}
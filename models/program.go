@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Program schedules routines over a number of weeks and declares how the
+// exercises progress from week to week.
+type Program struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `json:"name" bson:"name" binding:"required"`
+	Description  string             `json:"description" bson:"description"`
+	Weeks        int                `json:"weeks" bson:"weeks" binding:"required"`
+	Days         []ProgramDay       `json:"days" bson:"days"`
+	Progressions []Progression      `json:"progressions" bson:"progressions"`
+	UserID       primitive.ObjectID `json:"user_id" bson:"user_id"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// ProgramDay puts a routine on a day of the week, 1 being Monday. A day
+// with Week 0 repeats every week unless a day of a specific week replaces
+// it.
+type ProgramDay struct {
+	Week      int                `json:"week" bson:"week"`
+	Day       int                `json:"day" bson:"day"`
+	RoutineID primitive.ObjectID `json:"routine_id" bson:"routine_id"`
+}
+
+// Progression changes the sets of an exercise each week. Without RepRange
+// the weight grows by WeightIncrement every week. With RepRange the reps
+// climb from Min to Max one week at a time, then the weight grows by
+// WeightIncrement and the reps start over at Min. Every DeloadEvery weeks
+// the weight drops by DeloadPercent, and that week does not count as
+// progress. Like set weights, WeightIncrement is stored in kilograms and
+// Unit records the unit it was entered in.
+type Progression struct {
+	ExerciseID      primitive.ObjectID `json:"exercise_id" bson:"exercise_id"`
+	WeightIncrement float64            `json:"weight_increment" bson:"weight_increment"`
+	Unit            string             `json:"unit,omitempty" bson:"unit,omitempty"`
+	RepRange        *RepRange          `json:"rep_range,omitempty" bson:"rep_range,omitempty"`
+	DeloadEvery     int                `json:"deload_every,omitempty" bson:"deload_every,omitempty"`
+	DeloadPercent   float64            `json:"deload_percent,omitempty" bson:"deload_percent,omitempty"`
+}
+
+type RepRange struct {
+	Min int `json:"min" bson:"min"`
+	Max int `json:"max" bson:"max"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExerciseRevision records one change to an exercise. Snapshot holds the
+// exercise as it was after the change and is empty for deletions.
+type ExerciseRevision struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ExerciseID   primitive.ObjectID `bson:"exercise_id" json:"exercise_id"`
+	Revision     int                `bson:"revision" json:"revision"`
+	Action       string             `bson:"action" json:"action"`
+	Snapshot     *Exercise          `bson:"snapshot,omitempty" json:"snapshot,omitempty"`
+	RevertedFrom int                `bson:"reverted_from,omitempty" json:"reverted_from,omitempty"`
+	ChangedBy    string             `bson:"changed_by" json:"changed_by"`
+	ChangedAt    time.Time          `bson:"changed_at" json:"changed_at"`
+}
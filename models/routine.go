@@ -6,16 +6,57 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Set types. Sets stored before set types existed have no type and are
+// normal sets.
+const (
+	SetNormal   = "normal"
+	SetWarmup   = "warmup"
+	SetDrop     = "drop"
+	SetAMRAP    = "amrap"
+	SetTimed    = "timed"
+	SetDistance = "distance"
+)
+
+// SetTypes lists the allowed values of Set.Type.
+var SetTypes = []string{SetNormal, SetWarmup, SetDrop, SetAMRAP, SetTimed, SetDistance}
+
+// Set is one set of an exercise. Which fields apply depends on Type: drop
+// sets continue with Drops after the first Reps at Weight, AMRAP sets use
+// Reps as the minimum to reach, timed sets last Duration seconds and
+// distance sets cover Distance meters. Tempo is written as four digits
+// for the eccentric, bottom, concentric and top phases, e.g. "3-1-1-0",
+// with X for explosive. Effort is given as an RPE or an RIR target.
+//
+// Weight is stored in kilograms and Unit records the unit it was entered
+// in; responses convert weights to the unit the caller asks for.
 type Set struct {
+	Type     string     `json:"type,omitempty" bson:"type,omitempty"`
+	Reps     int        `json:"reps" bson:"reps"`
+	Weight   float64    `json:"weight" bson:"weight"`
+	Unit     string     `json:"unit,omitempty" bson:"unit,omitempty"`
+	Rest     int        `json:"rest" bson:"rest"`
+	Drops    []DropStep `json:"drops,omitempty" bson:"drops,omitempty"`
+	Duration int        `json:"duration,omitempty" bson:"duration,omitempty"`
+	Distance float64    `json:"distance,omitempty" bson:"distance,omitempty"`
+	Tempo    string     `json:"tempo,omitempty" bson:"tempo,omitempty"`
+	RPE      float64    `json:"rpe,omitempty" bson:"rpe,omitempty"`
+	RIR      *int       `json:"rir,omitempty" bson:"rir,omitempty"`
+}
+
+// DropStep is a lighter continuation of a drop set, done without rest.
+type DropStep struct {
 	Reps   int     `json:"reps" bson:"reps"`
 	Weight float64 `json:"weight" bson:"weight"`
-	Rest   int     `json:"rest" bson:"rest"`
 }
 
+// RoutineExercise is an exercise of a routine. Exercises with the same
+// Group are done back to back: two exercises form a superset, more form a
+// circuit.
 type RoutineExercise struct {
 	ExerciseID primitive.ObjectID `json:"exercise_id" bson:"exercise_id"`
 	Sets       []Set              `json:"sets" bson:"sets"`
 	Order      int                `json:"order" bson:"order"`
+	Group      string             `json:"group,omitempty" bson:"group,omitempty"`
 }
 
 type Routine struct {
@@ -26,4 +67,25 @@ type Routine struct {
 	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
 	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	// EstimatedMinutes is computed from the sets whenever the routine is
+	// saved.
+	EstimatedMinutes int `json:"estimated_minutes" bson:"estimated_minutes"`
+
+	// Template is set on routines published for others to clone.
+	// SourceTemplateID links a clone back to the template it was copied
+	// from.
+	Template         *RoutineTemplate    `json:"template,omitempty" bson:"template,omitempty"`
+	SourceTemplateID *primitive.ObjectID `json:"source_template_id,omitempty" bson:"source_template_id,omitempty"`
+}
+
+// RoutineTemplate describes who can see a published routine. Public
+// templates are visible to everyone, others only to users with one of
+// Roles.
+type RoutineTemplate struct {
+	Visibility string   `json:"visibility" bson:"visibility"`
+	Roles      []string `json:"roles,omitempty" bson:"roles,omitempty"`
+	Focus      string   `json:"focus,omitempty" bson:"focus,omitempty"`
 }
+
+// TemplateVisibilities lists the allowed values of RoutineTemplate.Visibility.
+var TemplateVisibilities = []string{"public", "roles"}
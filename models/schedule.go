@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScheduleEntry puts a routine on the calendar of its user, either once on
+// Date or every week on Weekdays (1 being Monday) from StartDate until the
+// optional EndDate. Dates are written as 2006-01-02. Time is an optional
+// start time such as 18:30 in Timezone, an IANA name that defaults to UTC;
+// entries without a time are all-day.
+type ScheduleEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	RoutineID primitive.ObjectID `json:"routine_id" bson:"routine_id" binding:"required"`
+	Date      string             `json:"date,omitempty" bson:"date,omitempty"`
+	Weekdays  []int              `json:"weekdays,omitempty" bson:"weekdays,omitempty"`
+	StartDate string             `json:"start_date,omitempty" bson:"start_date,omitempty"`
+	EndDate   string             `json:"end_date,omitempty" bson:"end_date,omitempty"`
+	Time      string             `json:"time,omitempty" bson:"time,omitempty"`
+	Timezone  string             `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session statuses.
+const (
+	SessionInProgress = "in_progress"
+	SessionFinished   = "finished"
+)
+
+// WorkoutSession records a workout as it was done. Sessions started from a
+// routine link to it and begin with its exercises and planned sets.
+// Duration is in seconds and set when the session is finished.
+type WorkoutSession struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	RoutineID  *primitive.ObjectID `json:"routine_id,omitempty" bson:"routine_id,omitempty"`
+	Name       string              `json:"name" bson:"name"`
+	Status     string              `json:"status" bson:"status"`
+	Exercises  []SessionExercise   `json:"exercises" bson:"exercises"`
+	Notes      string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	StartedAt  time.Time           `json:"started_at" bson:"started_at"`
+	FinishedAt *time.Time          `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	Duration   int                 `json:"duration,omitempty" bson:"duration,omitempty"`
+	UpdatedAt  time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// SessionExercise is an exercise of a session, planned by the routine or
+// added during the workout.
+type SessionExercise struct {
+	ExerciseID primitive.ObjectID `json:"exercise_id" bson:"exercise_id"`
+	Order      int                `json:"order" bson:"order"`
+	Group      string             `json:"group,omitempty" bson:"group,omitempty"`
+	Skipped    bool               `json:"skipped,omitempty" bson:"skipped,omitempty"`
+	Sets       []SessionSet       `json:"sets" bson:"sets"`
+}
+
+// SessionSet is a set as it was performed, next to the set the routine
+// planned if any. Like routine sets, Weight is stored in kilograms and
+// Unit records the unit it was logged in.
+type SessionSet struct {
+	Planned     *Set       `json:"planned,omitempty" bson:"planned,omitempty"`
+	Reps        int        `json:"reps" bson:"reps"`
+	Weight      float64    `json:"weight" bson:"weight"`
+	Unit        string     `json:"unit,omitempty" bson:"unit,omitempty"`
+	Duration    int        `json:"duration,omitempty" bson:"duration,omitempty"`
+	Distance    float64    `json:"distance,omitempty" bson:"distance,omitempty"`
+	RPE         float64    `json:"rpe,omitempty" bson:"rpe,omitempty"`
+	RIR         *int       `json:"rir,omitempty" bson:"rir,omitempty"`
+	Completed   bool       `json:"completed" bson:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
@@ -0,0 +1,33 @@
+package models
+
+// Weight units. Weights are stored in kilograms; the unit a weight was
+// entered in is kept next to it.
+const (
+	UnitKg = "kg"
+	UnitLb = "lb"
+
+	kgPerLb = 0.45359237
+)
+
+// WeightUnits lists the supported weight units.
+var WeightUnits = []string{UnitKg, UnitLb}
+
+// DefaultPlateIncrements is the smallest step a loaded bar can change by
+// in each unit, with the smallest common plates on both sides.
+var DefaultPlateIncrements = map[string]float64{UnitKg: 2.5, UnitLb: 5}
+
+// ToKg converts a weight in unit to kilograms.
+func ToKg(weight float64, unit string) float64 {
+	if unit == UnitLb {
+		return weight * kgPerLb
+	}
+	return weight
+}
+
+// FromKg converts a weight in kilograms to unit.
+func FromKg(weight float64, unit string) float64 {
+	if unit == UnitLb {
+		return weight / kgPerLb
+	}
+	return weight
+}
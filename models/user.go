@@ -6,6 +6,14 @@ type User struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Email    string             `bson:"email" json:"email" binding:"required"`
 	Password string             `bson:"password" json:"password" binding:"required"`
+	// Equipment IDs the user has access to, e.g. for a home gym
+	AvailableEquipment []string `bson:"available_equipment,omitempty" json:"available_equipment,omitempty"`
+	// Preferred weight unit and the smallest weight step the user can load,
+	// in that unit. Empty means kilograms and the default plate increment.
+	WeightUnit     string  `bson:"weight_unit,omitempty" json:"weight_unit,omitempty"`
+	PlateIncrement float64 `bson:"plate_increment,omitempty" json:"plate_increment,omitempty"`
+	// SHA-256 of the token in the user's calendar feed URL
+	CalendarTokenHash string `bson:"calendar_token_hash,omitempty" json:"-"`
 }
 
 type Application struct {
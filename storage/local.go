@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores files in a directory on the local filesystem. The directory
+// is expected to be served over HTTP at BaseURL.
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+// NewLocal creates dir if needed and returns a Local storage for it.
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *Local) Save(ctx context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a failed upload never leaves a
+	// partial file under the key.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Local) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Local) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+// path maps a key to a file inside Dir, rejecting keys that would escape it.
+func (s *Local) path(key string) (string, error) {
+	if !filepath.IsLocal(key) {
+		return "", errors.New("invalid storage key: " + key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
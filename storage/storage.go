@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Storage keeps uploaded files under keys such as
+// "exercises/<id>/<file>". Implementations must be safe for concurrent use.
+type Storage interface {
+	// Save writes the content of r under key, replacing any existing file.
+	Save(ctx context.Context, key string, r io.Reader) error
+	// Delete removes the file under key. Deleting a missing file is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the address clients download the file under key from.
+	URL(key string) string
+}